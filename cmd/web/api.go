@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justinas/nosurf"
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+// Request bodies larger than this are rejected with 413 Request Entity Too Large
+const maxJSONBodyBytes = 1 << 20
+
+// envelope wraps every JSON response in a named top-level key, e.g. {"snippet": {...}} or
+// {"error": {...}}, so responses can grow new keys without breaking clients
+type envelope map[string]any
+
+type apiErrorBody struct {
+	Status    int               `json:"status"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"` // only on 500s, to quote when reporting them
+}
+
+// The JSON representation of a snippet. Kept separate from models.Snippet so the API's shape
+// doesn't change whenever a column is added.
+type snippetResponse struct {
+	ID               int        `json:"id"`
+	Slug             string     `json:"slug"`
+	Title            string     `json:"title"`
+	Content          string     `json:"content"`
+	Language         string     `json:"language"`
+	Visibility       string     `json:"visibility"`
+	BurnAfterReading bool       `json:"burn_after_reading"`
+	Protected        bool       `json:"protected"`
+	AuthorID         int        `json:"author_id"`
+	Author           string     `json:"author"`
+	Created          time.Time  `json:"created"`
+	Updated          time.Time  `json:"updated"`
+	Expires          *time.Time `json:"expires"` // null if the snippet never expires
+}
+
+type snippetCreateRequest struct {
+	Title            string         `json:"title"`
+	Content          string         `json:"content"`
+	Language         string         `json:"language"`
+	Visibility       string         `json:"visibility"` // defaults to public
+	BurnAfterReading bool           `json:"burn_after_reading"`
+	Passphrase       string         `json:"passphrase"`
+	Expires          expiresRequest `json:"expires"`
+	ExpiresAt        time.Time      `json:"expires_at"` // when expires is "custom"
+}
+
+// expiresRequest takes the same values as the snippet form's expires field. It also accepts the
+// number of days the API used to take instead, 1, 7 or 365.
+type expiresRequest string
+
+func (e *expiresRequest) UnmarshalJSON(b []byte) error {
+	var days int
+	if json.Unmarshal(b, &days) == nil {
+		switch days {
+		case 1:
+			*e = "1d"
+		case 7:
+			*e = "1w"
+		case 365:
+			*e = "1y"
+		default:
+			// Left for validation to reject
+			*e = expiresRequest(strconv.Itoa(days))
+		}
+		return nil
+	}
+
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	*e = expiresRequest(s)
+	return nil
+}
+
+func newSnippetResponse(s *models.Snippet) snippetResponse {
+	var expires *time.Time
+	if !s.Expires.IsZero() {
+		expires = &s.Expires
+	}
+
+	return snippetResponse{
+		ID:               s.ID,
+		Slug:             s.Slug,
+		Title:            s.Title,
+		Content:          s.Content,
+		Language:         s.Language,
+		Visibility:       s.Visibility,
+		BurnAfterReading: s.BurnAfterReading,
+		Protected:        s.Protected,
+		AuthorID:         s.UserID,
+		Author:           s.Author,
+		Created:          s.Created,
+		Updated:          s.Updated,
+		Expires:          expires,
+	}
+}
+
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	opts, err := readListOptions(r.URL.Query())
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.ViewerID = app.authenticatedUserID(r)
+
+	page, err := app.snippets.List(opts)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.apiError(w, http.StatusBadRequest, "invalid cursor parameter")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	snippets := make([]snippetResponse, 0, len(page.Snippets))
+	for _, s := range page.Snippets {
+		resp := newSnippetResponse(s)
+		// Protected snippets are listed, but without their content
+		if !app.isUnlocked(r, s) {
+			resp.Content = ""
+		}
+		snippets = append(snippets, resp)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippets": snippets, "next": page.Next, "prev": page.Prev}, nil)
+}
+
+func (app *application) apiSnippetView(w http.ResponseWriter, r *http.Request) {
+	slug, err := readSlugParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	s, err := app.snippets.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	if !s.VisibleTo(app.authenticatedUserID(r)) {
+		app.apiNotFound(w)
+		return
+	}
+
+	if !app.isUnlocked(r, s) {
+		app.apiError(w, http.StatusForbidden, "the snippet is protected by a passphrase")
+		return
+	}
+
+	// Fetching a burn after reading snippet through the API reads it, whoever asks
+	if s.BurnAfterReading {
+		s, err = app.snippets.Consume(s.ID)
+		if err != nil {
+			if errors.Is(err, models.ErrGone) {
+				app.apiGone(w)
+			} else if errors.Is(err, models.ErrNoRecord) {
+				app.apiNotFound(w)
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newSnippetResponse(s)}, nil)
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var input snippetCreateRequest
+	if !app.readJSON(w, r, &input) {
+		return
+	}
+
+	if input.Visibility == "" {
+		input.Visibility = models.VisibilityPublic
+	}
+
+	// Validate exactly like the HTML form does
+	form := snippetCreateForm{
+		Title:            input.Title,
+		Content:          input.Content,
+		Language:         input.Language,
+		Visibility:       input.Visibility,
+		BurnAfterReading: input.BurnAfterReading,
+		Passphrase:       input.Passphrase,
+		Expires:          string(input.Expires),
+	}
+	if !input.ExpiresAt.IsZero() {
+		form.ExpiresAt = input.ExpiresAt.UTC().Format(expiresAtLayout)
+	}
+	form.validate()
+
+	if !form.Valid() {
+		app.apiFailedValidation(w, form.FieldErrors)
+		return
+	}
+
+	created, err := app.createSnippet(form, app.authenticatedUserID(r))
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	// Read it back for the fields the database fills in, like the author and timestamps
+	s, err := app.snippets.Get(created.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/snippets/%s", s.Slug))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": newSnippetResponse(s)}, headers)
+}
+
+// Encodes data as JSON and writes it with the given status and any extra headers
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		// Only reachable through a bug, the envelopes only hold types that always encode
+		app.logger.Error(err.Error(), "trace", string(debug.Stack()))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// Decodes a JSON request body into dst, writing the appropriate error response and returning false
+// if the body isn't a single, well-formed JSON value of the right shape
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		app.apiError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.apiError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit))
+		case errors.As(err, &syntaxError):
+			app.apiError(w, http.StatusBadRequest, fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxError.Offset))
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			app.apiError(w, http.StatusBadRequest, "body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			app.apiError(w, http.StatusBadRequest, fmt.Sprintf("body contains the wrong type for field %q", unmarshalTypeError.Field))
+		case errors.Is(err, io.EOF):
+			app.apiError(w, http.StatusBadRequest, "body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			app.apiError(w, http.StatusBadRequest, fmt.Sprintf("body contains unknown field %s", field))
+		default:
+			app.apiError(w, http.StatusBadRequest, err.Error())
+		}
+		return false
+	}
+
+	// Anything after the first value means the body wasn't a single JSON value
+	if err = dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		app.apiError(w, http.StatusBadRequest, "body must only contain a single JSON value")
+		return false
+	}
+
+	return true
+}
+
+// Writes the standard error envelope, e.g. {"error": {"status": 404, "message": "..."}}
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": apiErrorBody{Status: status, Message: message}}, nil)
+}
+
+// JSON counterpart of serverError, the details are only logged and never sent to the client
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	status := http.StatusInternalServerError
+	body := apiErrorBody{
+		Status:    status,
+		Message:   "the server encountered a problem and could not process your request",
+		RequestID: requestID(r),
+	}
+	app.writeJSON(w, status, envelope{"error": body}, nil)
+}
+
+func (app *application) apiNotFound(w http.ResponseWriter) {
+	app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+}
+
+func (app *application) apiGone(w http.ResponseWriter) {
+	app.apiError(w, http.StatusGone, "the snippet was burned after it was read")
+}
+
+// Maps a validator's FieldErrors to a 422 response, using the same messages as the HTML forms
+func (app *application) apiFailedValidation(w http.ResponseWriter, fieldErrors map[string]string) {
+	status := http.StatusUnprocessableEntity
+	body := apiErrorBody{Status: status, Message: "the request failed validation", Fields: fieldErrors}
+	app.writeJSON(w, status, envelope{"error": body}, nil)
+}
+
+// API counterpart of requireAuthentication, responding with 401 instead of redirecting to the
+// login page
+func (app *application) apiRequireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.apiError(w, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Authenticates requests carrying an "Authorization: Bearer <token>" header with a personal access
+// token, setting the same authenticated-user context as authenticate. Requests without the header
+// carry on to the session-based authenticate middleware.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Let caches know the response depends on who is asking
+		w.Header().Add("Vary", "Authorization")
+
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		plaintext, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok || plaintext == "" {
+			app.apiInvalidToken(w)
+			return
+		}
+
+		token, err := app.tokens.Authenticate(plaintext)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.apiInvalidToken(w)
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserIDContextKey, token.UserID)
+		ctx = context.WithValue(ctx, tokenContextKey, token)
+		setRequestUserID(r, token.UserID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Returns middleware rejecting token-authenticated requests whose token wasn't granted scope.
+// Session-authenticated and anonymous requests aren't limited by scopes.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := contextToken(r)
+			if token != nil && !token.HasScope(scope) {
+				app.apiError(w, http.StatusForbidden, fmt.Sprintf("this token does not have the %q scope", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Returns the personal access token the request was authenticated with, or nil if it wasn't
+// authenticated by token
+func contextToken(r *http.Request) *models.Token {
+	token, _ := r.Context().Value(tokenContextKey).(*models.Token)
+	return token
+}
+
+func (app *application) apiInvalidToken(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.apiError(w, http.StatusUnauthorized, "invalid or missing authentication token")
+}
+
+// Same CSRF protection as noSurf, but failures get the JSON error envelope instead of nosurf's
+// plain text response. Browser scripts send the token in the X-CSRF-Token header.
+//
+// Requests authenticated by a personal access token are exempt: a browser never attaches the
+// Authorization header by itself, so a cross-site request can't carry one.
+func (app *application) apiNoSurf(next http.Handler) http.Handler {
+	csrfHandler := newCSRFHandler(next)
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return contextToken(r) != nil
+	})
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.apiError(w, http.StatusForbidden, fmt.Sprintf("CSRF check failed: %v", nosurf.Reason(r)))
+	}))
+
+	return csrfHandler
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+	"github.com/mhrdini/snippetbox/internal/models/mocks"
+)
+
+func TestAPISnippetView(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Valid ID",
+			path:       "/api/v1/snippets/" + mocks.MockSnippet.Slug,
+			wantStatus: http.StatusOK,
+			wantBody:   `"content": "` + mocks.MockSnippet.Content + `"`,
+		},
+		{
+			name:       "Non-existent ID",
+			path:       "/api/v1/snippets/N0Sn1ppetX",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `"status": 404`,
+		},
+		{
+			name:       "Unknown route",
+			path:       "/api/v1/nothing",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `"status": 404`,
+		},
+		{
+			name:       "List",
+			path:       "/api/v1/snippets?author=2",
+			wantStatus: http.StatusOK,
+			wantBody:   `"title": "` + mocks.MockOtherSnippet.Title + `"`,
+		},
+		{
+			name:       "List with invalid sort",
+			path:       "/api/v1/snippets?sort=random",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"message": "invalid sort parameter"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, body := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			assert.Equal(t, header.Get("Content-Type"), "application/json")
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAPISnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Browser scripts using the session cookie send the CSRF token in a header
+	csrfToken := ts.login(t)
+
+	const validBody = `{"title": "O snail", "content": "O snail\nClimb Mount Fuji", "expires": 7}`
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name:        "Valid",
+			contentType: "application/json",
+			body:        validBody,
+			wantStatus:  http.StatusCreated,
+			wantBody:    `"snippet"`,
+		},
+		{
+			name:        "Never expires",
+			contentType: "application/json",
+			body:        `{"title": "O snail", "content": "Climb Mount Fuji", "expires": "never"}`,
+			wantStatus:  http.StatusCreated,
+			wantBody:    `"snippet"`,
+		},
+		{
+			name:        "Custom expiry in the past",
+			contentType: "application/json",
+			body:        `{"title": "O snail", "content": "Climb Mount Fuji", "expires": "custom", "expires_at": "2001-01-01T00:00:00Z"}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantBody:    `"expires_at": "This field must be in the future"`,
+		},
+		{
+			name:        "Wrong content type",
+			contentType: "application/x-www-form-urlencoded",
+			body:        validBody,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Failed validation",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"title": "", "content": "O snail", "expires": 2}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantBody:    `"expires": "This field must equal 10m, 1h, 1d, 1w, 1mo, 1y, never or custom"`,
+		},
+		{
+			name:        "Unknown field",
+			contentType: "application/json",
+			body:        `{"title": "O snail", "author": "Issa"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    `unknown field \"author\"`,
+		},
+		{
+			name:        "Multiple values",
+			contentType: "application/json",
+			body:        validBody + validBody,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Too large",
+			contentType: "application/json",
+			body:        `{"title": "O snail", "content": "` + strings.Repeat("a", maxJSONBodyBytes) + `"}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Content-Type", tt.contentType)
+			header.Set("X-CSRF-Token", csrfToken)
+			header.Set("Referer", ts.URL)
+
+			status, _, body := ts.do(t, http.MethodPost, "/api/v1/snippets", header, tt.body)
+
+			assert.Equal(t, status, tt.wantStatus)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAPISnippetCreateUnauthenticated(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	status, _, _ := ts.do(t, http.MethodPost, "/api/v1/snippets", http.Header{"Content-Type": {"application/json"}}, `{}`)
+
+	// Without a session the CSRF check is the first thing to reject the request
+	assert.Equal(t, status, http.StatusForbidden)
+}
+
+func TestAPIBearerToken(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const body = `{"title": "O snail", "content": "O snail\nClimb Mount Fuji", "expires": 7}`
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		wantStatus    int
+	}{
+		{
+			name:          "Create with write token, no CSRF token",
+			method:        http.MethodPost,
+			path:          "/api/v1/snippets",
+			authorization: "Bearer " + mocks.ValidWriteToken,
+			wantStatus:    http.StatusCreated,
+		},
+		{
+			name:          "Create with read token",
+			method:        http.MethodPost,
+			path:          "/api/v1/snippets",
+			authorization: "Bearer " + mocks.ValidReadToken,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "Get with read token",
+			method:        http.MethodGet,
+			path:          "/api/v1/snippets/" + mocks.MockSnippet.Slug,
+			authorization: "Bearer " + mocks.ValidReadToken,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Invalid token",
+			method:        http.MethodGet,
+			path:          "/api/v1/snippets/" + mocks.MockSnippet.Slug,
+			authorization: "Bearer sbx_nope",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong scheme",
+			method:        http.MethodGet,
+			path:          "/api/v1/snippets/" + mocks.MockSnippet.Slug,
+			authorization: "Basic " + mocks.ValidReadToken,
+			wantStatus:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Authorization", tt.authorization)
+			header.Set("Content-Type", "application/json")
+
+			status, _, _ := ts.do(t, tt.method, tt.path, header, body)
+
+			assert.Equal(t, status, tt.wantStatus)
+		})
+	}
+}
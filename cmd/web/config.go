@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variables that override the config file, e.g. SNIPPETBOX_ADDR for
+// -addr and SNIPPETBOX_SHUTDOWN_TIMEOUT for -shutdown-timeout
+const envPrefix = "SNIPPETBOX_"
+
+type Config struct {
+	Addr            string
+	MetricsAddr     string
+	DSN             string
+	TLSCertFile     string
+	TLSKeyFile      string
+	SessionLifetime time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	BcryptCost      int
+	JanitorInterval time.Duration
+	Retention       time.Duration
+	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	LogFormat       string
+	TrustedProxies  prefixList
+	RateLimit       bool
+	BaseURL         string
+	SMTPHost        string
+	SMTPPort        int
+	SMTPUsername    string
+	SMTPPassword    string
+	MailSender      string
+	OutboxDir       string
+
+	ConfigFile  string // JSON, TOML or YAML file the settings were loaded from, if any
+	PrintConfig bool   // print the effective config and exit instead of serving
+}
+
+// Defines a flag for every setting, bound to cfg's fields with their current values as defaults.
+// The flag names double as the config file's keys and, upper-cased, the environment variables'
+// names.
+func (cfg *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "HTTP network address")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "Network address to serve Prometheus metrics on over plain HTTP, empty to not serve them")
+	fs.StringVar(&cfg.DSN, "dsn", cfg.DSN, "MySQL database connection string, must set parseTime=true")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", cfg.TLSCertFile, "Path to the TLS certificate")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", cfg.TLSKeyFile, "Path to the TLS private key")
+	fs.DurationVar(&cfg.SessionLifetime, "session-lifetime", cfg.SessionLifetime, "How long sessions last")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "How long to wait for a request's headers and body")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "How long to take writing a response")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "How long to keep idle keep-alive connections open")
+	fs.IntVar(&cfg.BcryptCost, "bcrypt-cost", cfg.BcryptCost, "Cost of hashing passwords and passphrases")
+	fs.DurationVar(&cfg.JanitorInterval, "janitor-interval", cfg.JanitorInterval, "How often to purge expired data, 0 to never")
+	fs.DurationVar(&cfg.Retention, "retention", cfg.Retention, "How long to keep snippets after they expire or are burned")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "How long to let in-flight requests finish when shutting down")
+	fs.DurationVar(&cfg.DrainDelay, "drain-delay", cfg.DrainDelay, "How long to keep serving while /readyz fails before shutting down")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Format of the log, text or json")
+	fs.Var(&cfg.TrustedProxies, "trusted-proxies", "Comma-separated IPs and CIDR ranges of the reverse proxies whose X-Request-ID and X-Forwarded-For headers are trusted")
+	fs.BoolVar(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "Limit how often each client can make requests")
+	fs.StringVar(&cfg.BaseURL, "base-url", cfg.BaseURL, "URL the site is reached at, used for links in emails")
+	fs.StringVar(&cfg.SMTPHost, "smtp-host", cfg.SMTPHost, "SMTP server to send email through, empty to write it to the outbox instead")
+	fs.IntVar(&cfg.SMTPPort, "smtp-port", cfg.SMTPPort, "Port of the SMTP server")
+	fs.StringVar(&cfg.SMTPUsername, "smtp-username", cfg.SMTPUsername, "Username for the SMTP server, empty to not authenticate")
+	fs.StringVar(&cfg.SMTPPassword, "smtp-password", cfg.SMTPPassword, "Password for the SMTP server")
+	fs.StringVar(&cfg.MailSender, "mail-sender", cfg.MailSender, "From address of the email sent")
+	fs.StringVar(&cfg.OutboxDir, "outbox-dir", cfg.OutboxDir, "Directory email is written to when there's no SMTP server")
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Addr:            ":8000",
+		MetricsAddr:     "localhost:9000",
+		DSN:             "web:web@/snippetbox?parseTime=true",
+		TLSCertFile:     "../../tls/cert.pem",
+		TLSKeyFile:      "../../tls/key.pem",
+		SessionLifetime: 12 * time.Hour,
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		IdleTimeout:     time.Minute,
+		BcryptCost:      12,
+		JanitorInterval: 10 * time.Minute,
+		Retention:       7 * 24 * time.Hour,
+		ShutdownTimeout: 30 * time.Second,
+		LogFormat:       logFormatText,
+		RateLimit:       true,
+		BaseURL:         "https://localhost:8000",
+		SMTPPort:        587,
+		MailSender:      "Snippetbox <no-reply@localhost>",
+		OutboxDir:       "tmp/outbox",
+	}
+}
+
+// loadConfig builds the config from, in increasing order of precedence, the defaults, the config
+// file named by -config or SNIPPETBOX_CONFIG, SNIPPETBOX_* environment variables and the flags
+// in args. The result is validated, with every problem reported in the error.
+func loadConfig(name string, args []string, getenv func(string) string, output io.Writer) (*Config, error) {
+	// Flags are parsed first to find the config file, but only applied once the file and the
+	// environment have been
+	flags := defaultConfig()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&flags.ConfigFile, "config", getenv(envPrefix+"CONFIG"), "Path to a JSON, TOML or YAML config file")
+	fs.BoolVar(&flags.PrintConfig, "print-config", false, "Print the effective config, with secrets redacted, and exit")
+	flags.bindFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	cfg.ConfigFile = flags.ConfigFile
+	cfg.PrintConfig = flags.PrintConfig
+
+	settings := flag.NewFlagSet(name, flag.ContinueOnError)
+	cfg.bindFlags(settings)
+
+	if cfg.ConfigFile != "" {
+		err = loadConfigFile(settings, cfg.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	settings.VisitAll(func(f *flag.Flag) {
+		key := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value := getenv(key); value != "" {
+			if err := settings.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	})
+
+	fs.Visit(func(f *flag.Flag) {
+		if settings.Lookup(f.Name) != nil {
+			// Already parsed once, so it can't fail
+			settings.Set(f.Name, f.Value.String())
+		}
+	})
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+
+	return cfg, nil
+}
+
+// Applies the settings in a config file, a table with a key for each flag's name, e.g.
+// {"addr": ":443", "shutdown-timeout": "1m", "bcrypt-cost": 12}. Files ending in .toml are read
+// as TOML, .yaml or .yml as YAML and anything else as JSON.
+func loadConfigFile(settings *flag.FlagSet, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var values map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(b, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	default:
+		err = json.Unmarshal(b, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		value := values[key]
+		if settings.Lookup(key) == nil {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+			continue
+		}
+
+		// JSON numbers decode as float64, TOML integers as int64 and YAML ones as int
+		switch value.(type) {
+		case string, float64, int64, int, bool:
+		default:
+			errs = append(errs, fmt.Errorf("%s: %s must be a string, number or boolean", path, key))
+			continue
+		}
+
+		err = settings.Set(key, fmt.Sprint(value))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Checks that the settings make sense together, returning a clear error for each one that doesn't
+func (cfg *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Addr != "", "addr must not be empty")
+	check(cfg.MetricsAddr == "" || cfg.MetricsAddr != cfg.Addr, "metrics-addr must differ from addr")
+
+	dsn, err := mysql.ParseDSN(cfg.DSN)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("dsn: %w", err))
+	} else {
+		check(dsn.ParseTime, "dsn must set parseTime=true")
+	}
+
+	// Printing the config doesn't need the files, which may only exist where the server runs
+	if !cfg.PrintConfig {
+		_, err = os.Stat(cfg.TLSCertFile)
+		check(err == nil, "tls-cert: %v", err)
+		_, err = os.Stat(cfg.TLSKeyFile)
+		check(err == nil, "tls-key: %v", err)
+	}
+
+	check(cfg.SessionLifetime > 0, "session-lifetime must be positive")
+	check(cfg.ReadTimeout > 0, "read-timeout must be positive")
+	check(cfg.WriteTimeout > 0, "write-timeout must be positive")
+	check(cfg.IdleTimeout > 0, "idle-timeout must be positive")
+	check(cfg.BcryptCost >= bcrypt.MinCost && cfg.BcryptCost <= bcrypt.MaxCost, "bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(cfg.JanitorInterval >= 0, "janitor-interval must not be negative")
+	check(cfg.Retention >= 0, "retention must not be negative")
+	check(cfg.ShutdownTimeout > 0, "shutdown-timeout must be positive")
+	check(cfg.DrainDelay >= 0, "drain-delay must not be negative")
+	check(cfg.LogFormat == logFormatText || cfg.LogFormat == logFormatJSON, "log-format must be text or json")
+
+	baseURL, err := url.Parse(cfg.BaseURL)
+	check(err == nil && (baseURL.Scheme == "http" || baseURL.Scheme == "https") && baseURL.Host != "",
+		"base-url must be an absolute http or https URL")
+	check(cfg.SMTPPort > 0 && cfg.SMTPPort <= 65535, "smtp-port must be between 1 and 65535")
+	check(cfg.SMTPHost != "" || cfg.OutboxDir != "", "outbox-dir must be set when smtp-host isn't")
+	_, err = mail.ParseAddress(cfg.MailSender)
+	check(err == nil, "mail-sender: %v", err)
+
+	return errs
+}
+
+// Reports whether the server is being run for development, going by whether -base-url points at
+// the machine it's running on
+func (cfg *Config) isDevelopment() bool {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.IsLoopback()
+}
+
+// prefixList is a flag.Value for a comma-separated list of IP addresses and CIDR ranges, e.g.
+// "10.0.0.0/8,::1". A bare address stands for a range of just itself.
+type prefixList []netip.Prefix
+
+func (l *prefixList) String() string {
+	parts := make([]string, len(*l))
+	for i, prefix := range *l {
+		parts[i] = prefix.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set replaces the list, rather than adding to it, so a later layer overrides an earlier one
+func (l *prefixList) Set(value string) error {
+	var prefixes prefixList
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if strings.Contains(part, "/") {
+			prefix, err := netip.ParsePrefix(part)
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	*l = prefixes
+	return nil
+}
+
+// Reports whether addr is in any of the list's ranges
+func (l prefixList) contains(addr netip.Addr) bool {
+	// IPv4 clients of a dual-stack listener show up as IPv4-mapped IPv6 addresses
+	addr = addr.Unmap()
+	for _, prefix := range l {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes the effective settings as JSON, in the same shape the config file takes. The database
+// and SMTP passwords are redacted.
+func (cfg *Config) print(w io.Writer) error {
+	redacted := *cfg
+	if dsn, err := mysql.ParseDSN(cfg.DSN); err == nil && dsn.Passwd != "" {
+		dsn.Passwd = "REDACTED"
+		redacted.DSN = dsn.FormatDSN()
+	}
+	if cfg.SMTPPassword != "" {
+		redacted.SMTPPassword = "REDACTED"
+	}
+
+	settings := flag.NewFlagSet("", flag.ContinueOnError)
+	redacted.bindFlags(settings)
+
+	values := map[string]string{}
+	settings.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+
+	b, err := json.MarshalIndent(values, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+// Writes contents to a file called name in a new temporary directory, returning its path
+func writeTempFile(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(contents), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	cert := writeTempFile(t, "cert.pem", "")
+	key := writeTempFile(t, "key.pem", "")
+	tlsArgs := []string{"-tls-cert", cert, "-tls-key", key}
+
+	file := writeTempFile(t, "config.json", `{"addr": ":4000", "read-timeout": "1s", "write-timeout": "2s", "bcrypt-cost": 10}`)
+
+	env := map[string]string{
+		"SNIPPETBOX_CONFIG":        file,
+		"SNIPPETBOX_READ_TIMEOUT":  "3s",
+		"SNIPPETBOX_WRITE_TIMEOUT": "4s",
+	}
+
+	cfg, err := loadConfig("web", append(tlsArgs, "-write-timeout", "5s"), func(key string) string { return env[key] }, io.Discard)
+	assert.NilError(t, err)
+
+	// Each layer overrides the ones before it
+	assert.Equal(t, cfg.IdleTimeout, time.Minute)    // default
+	assert.Equal(t, cfg.Addr, ":4000")               // file
+	assert.Equal(t, cfg.BcryptCost, 10)              // file
+	assert.Equal(t, cfg.ReadTimeout, 3*time.Second)  // environment
+	assert.Equal(t, cfg.WriteTimeout, 5*time.Second) // flag
+}
+
+func TestLoadConfigFileFormats(t *testing.T) {
+	cert := writeTempFile(t, "cert.pem", "")
+	key := writeTempFile(t, "key.pem", "")
+	tlsArgs := []string{"-tls-cert", cert, "-tls-key", key}
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{
+			name:     "config.json",
+			contents: `{"addr": ":4000", "shutdown-timeout": "1m", "bcrypt-cost": 10, "rate-limit": false}`,
+		},
+		{
+			name:     "config.toml",
+			contents: "addr = \":4000\"\nshutdown-timeout = \"1m\"\nbcrypt-cost = 10\nrate-limit = false\n",
+		},
+		{
+			name:     "config.yaml",
+			contents: "addr: \":4000\"\nshutdown-timeout: 1m\nbcrypt-cost: 10\nrate-limit: false\n",
+		},
+		{
+			name:     "config.yml",
+			contents: "addr: \":4000\"\nshutdown-timeout: 1m\nbcrypt-cost: 10\nrate-limit: false\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tlsArgs, "-config", writeTempFile(t, tt.name, tt.contents))
+			cfg, err := loadConfig("web", args, func(string) string { return "" }, io.Discard)
+			assert.NilError(t, err)
+
+			assert.Equal(t, cfg.Addr, ":4000")
+			assert.Equal(t, cfg.ShutdownTimeout, time.Minute)
+			assert.Equal(t, cfg.BcryptCost, 10)
+			assert.Equal(t, cfg.RateLimit, false)
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	cert := writeTempFile(t, "cert.pem", "")
+	key := writeTempFile(t, "key.pem", "")
+	tlsArgs := []string{"-tls-cert", cert, "-tls-key", key}
+
+	noEnv := func(string) string { return "" }
+
+	tests := []struct {
+		name    string
+		args    []string
+		getenv  func(string) string
+		wantErr string
+	}{
+		{
+			name:    "Unknown file setting",
+			args:    append(tlsArgs, "-config", writeTempFile(t, "config.json", `{"adress": ":4000"}`)),
+			getenv:  noEnv,
+			wantErr: `unknown setting "adress"`,
+		},
+		{
+			name:    "Malformed TOML file",
+			args:    append(tlsArgs, "-config", writeTempFile(t, "config.toml", `addr = `)),
+			getenv:  noEnv,
+			wantErr: "parsing config file",
+		},
+		{
+			name:    "Nested YAML setting",
+			args:    append(tlsArgs, "-config", writeTempFile(t, "config.yaml", "addr:\n  port: 4000\n")),
+			getenv:  noEnv,
+			wantErr: "addr must be a string, number or boolean",
+		},
+		{
+			name:    "Malformed file",
+			args:    append(tlsArgs, "-config", writeTempFile(t, "config.json", `{"addr": `)),
+			getenv:  noEnv,
+			wantErr: "parsing config file",
+		},
+		{
+			name:    "Bad environment value",
+			args:    tlsArgs,
+			getenv:  func(key string) string { return map[string]string{"SNIPPETBOX_IDLE_TIMEOUT": "soon"}[key] },
+			wantErr: "SNIPPETBOX_IDLE_TIMEOUT",
+		},
+		{
+			name:    "DSN without parseTime",
+			args:    append(tlsArgs, "-dsn", "web:web@/snippetbox"),
+			getenv:  noEnv,
+			wantErr: "dsn must set parseTime=true",
+		},
+		{
+			name:    "Missing TLS certificate",
+			args:    []string{"-tls-cert", "missing.pem", "-tls-key", key},
+			getenv:  noEnv,
+			wantErr: "tls-cert: stat missing.pem",
+		},
+		{
+			name:    "Unknown log format",
+			args:    append(tlsArgs, "-log-format", "xml"),
+			getenv:  noEnv,
+			wantErr: "log-format must be text or json",
+		},
+		{
+			name:    "Malformed trusted proxy",
+			args:    append(tlsArgs, "-trusted-proxies", "10.0.0.1,10.0.0.0/33"),
+			getenv:  noEnv,
+			wantErr: `invalid value "10.0.0.1,10.0.0.0/33" for flag -trusted-proxies`,
+		},
+		{
+			name:    "Relative base URL",
+			args:    append(tlsArgs, "-base-url", "snippetbox.example.com"),
+			getenv:  noEnv,
+			wantErr: "base-url must be an absolute http or https URL",
+		},
+		{
+			name:    "Malformed mail sender",
+			args:    append(tlsArgs, "-mail-sender", "Snippetbox"),
+			getenv:  noEnv,
+			wantErr: "mail-sender: mail: ",
+		},
+		{
+			name:    "Out of range",
+			args:    append(tlsArgs, "-bcrypt-cost", "99", "-shutdown-timeout", "0s"),
+			getenv:  noEnv,
+			wantErr: "bcrypt-cost must be between 4 and 31\nshutdown-timeout must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig("web", tt.args, tt.getenv, io.Discard)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			assert.StringContains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadConfigPrintWithoutTLSFiles(t *testing.T) {
+	// The TLS files only need to exist to serve, not to print the config
+	args := []string{"-print-config", "-tls-cert", "missing.pem", "-tls-key", "missing.pem"}
+	cfg, err := loadConfig("web", args, func(string) string { return "" }, io.Discard)
+	assert.NilError(t, err)
+	assert.Equal(t, cfg.PrintConfig, true)
+}
+
+func TestConfigPrint(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.DSN = "web:hunter2@tcp(db:3306)/snippetbox?parseTime=true"
+	cfg.SMTPPassword = "hunter3"
+
+	var buf bytes.Buffer
+	err := cfg.print(&buf)
+	assert.NilError(t, err)
+
+	assert.StringContains(t, buf.String(), `"dsn": "web:REDACTED@tcp(db:3306)/snippetbox?parseTime=true"`)
+	assert.StringContains(t, buf.String(), `"smtp-password": "REDACTED"`)
+	assert.StringContains(t, buf.String(), `"shutdown-timeout": "30s"`)
+	if bytes.Contains(buf.Bytes(), []byte("hunter2")) {
+		t.Error("printed config contains the database password")
+	}
+	if bytes.Contains(buf.Bytes(), []byte("hunter3")) {
+		t.Error("printed config contains the SMTP password")
+	}
+}
+
+func TestConfigIsDevelopment(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    bool
+	}{
+		{baseURL: "https://localhost:8000", want: true},
+		{baseURL: "http://127.0.0.1:4000", want: true},
+		{baseURL: "https://[::1]", want: true},
+		{baseURL: "https://snippetbox.example.com", want: false},
+		{baseURL: "https://192.0.2.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.BaseURL = tt.baseURL
+			assert.Equal(t, cfg.isDevelopment(), tt.want)
+		})
+	}
+}
@@ -2,4 +2,9 @@ package main
 
 type contextKey string
 
+const requestIDContextKey = contextKey("requestID")
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const authenticatedUserIDContextKey = contextKey("authenticatedUserID")
+const snippetContextKey = contextKey("snippet")
+const tokenContextKey = contextKey("token")
+const requestFieldsContextKey = contextKey("requestFields")
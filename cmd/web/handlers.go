@@ -3,18 +3,163 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/mhrdini/snippetbox/internal/diff"
+	"github.com/mhrdini/snippetbox/internal/highlight"
 	"github.com/mhrdini/snippetbox/internal/models"
 	"github.com/mhrdini/snippetbox/internal/validator"
 )
 
+// An expiry period offered on the snippet form, add returns the expiry time for a snippet saved at
+// the given time and is nil for snippets that never expire
+type expiryOption struct {
+	Value string
+	Label string
+	add   func(time.Time) time.Time
+}
+
+var expiryOptions = []expiryOption{
+	{Value: "10m", Label: "In 10 minutes", add: func(t time.Time) time.Time { return t.Add(10 * time.Minute) }},
+	{Value: "1h", Label: "In 1 hour", add: func(t time.Time) time.Time { return t.Add(time.Hour) }},
+	{Value: "1d", Label: "In 1 day", add: func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{Value: "1w", Label: "In 1 week", add: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }},
+	{Value: "1mo", Label: "In 1 month", add: func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{Value: "1y", Label: "In 1 year", add: func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{Value: "never", Label: "Never"},
+}
+
+func findExpiryOption(value string) (expiryOption, bool) {
+	for _, opt := range expiryOptions {
+		if opt.Value == value {
+			return opt, true
+		}
+	}
+	return expiryOption{}, false
+}
+
+// The expires value that takes the expiry time from expires_at instead of expiryOptions
+const customExpiry = "custom"
+
+// The expires value that leaves an edited snippet's expiry as it is
+const keepExpiry = "keep"
+
+// Layout of the expires_at field, which is what a datetime-local input submits. It's read as UTC.
+const expiresAtLayout = "2006-01-02T15:04"
+
 type snippetCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Language            string `form:"language"` // empty to detect it from the content
+	Visibility          string `form:"visibility"`
+	BurnAfterReading    bool   `form:"burn"`
+	Passphrase          string `form:"passphrase"` // empty for no passphrase
+	Expires             string `form:"expires"`    // the Value of one of expiryOptions, customExpiry or keepExpiry
+	ExpiresAt           string `form:"expires_at"` // in expiresAtLayout, only used for customExpiry
+	Tags                string `form:"tags"`       // comma or space separated
+	validator.Validator `form:"-"`
+	// editing is set when the form edits an existing snippet, the only time keepExpiry is allowed
+	editing bool
+}
+
+// Check each value:
+// - title is not blank and not more than 100 chars long
+// - content is not blank
+// - language is empty or a supported language
+// - visibility is public, unlisted or private
+// - passphrase is empty, or between 8 chars and 72 bytes long, the most bcrypt will hash
+// - expires value is one of expiryOptions, custom with a future expires_at, or keep when editing
+// - there are at most 5 tags, each made of lowercase letters, digits and hyphens and at most 30
+// chars long
+func (form *snippetCreateForm) validate() {
+	tags := parseTags(form.Tags)
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(form.Language == "" || highlight.Valid(form.Language), "language", "This field must be a supported language")
+	form.CheckField(validator.ValidValue(form.Visibility, models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate), "visibility", "This field must equal public, unlisted or private")
+	form.CheckField(form.Passphrase == "" || validator.MinChars(form.Passphrase, 8), "passphrase", "This field must be at least 8 characters")
+	form.CheckField(len(form.Passphrase) <= 72, "passphrase", "This field cannot be more than 72 bytes long")
+	_, ok := findExpiryOption(form.Expires)
+	if form.editing {
+		form.CheckField(ok || form.Expires == customExpiry || form.Expires == keepExpiry, "expires", "This field must equal 10m, 1h, 1d, 1w, 1mo, 1y, never, custom or keep")
+	} else {
+		form.CheckField(ok || form.Expires == customExpiry, "expires", "This field must equal 10m, 1h, 1d, 1w, 1mo, 1y, never or custom")
+	}
+	if form.Expires == customExpiry {
+		expiresAt, err := time.Parse(expiresAtLayout, form.ExpiresAt)
+		form.CheckField(err == nil, "expires_at", "This field must be a date and time")
+		form.CheckField(err != nil || expiresAt.After(time.Now()), "expires_at", "This field must be in the future")
+	}
+	form.CheckField(validator.MaxCount(tags, 5), "tags", "This field cannot have more than 5 tags")
+	form.CheckField(validator.AllMatch(tags, validator.TagRX), "tags", "Tags can only contain lowercase letters, numbers and hyphens")
+	form.CheckField(validator.AllMaxChars(tags, 30), "tags", "Tags cannot be more than 30 characters long")
+}
+
+// Returns the chosen language, or the one detected from the content if none was chosen
+func (form *snippetCreateForm) language() string {
+	if form.Language == "" {
+		return highlight.Detect(form.Content)
+	}
+	return form.Language
+}
+
+// Returns when a snippet saved from the form at the given time should expire, or the zero time if
+// it never should or its expiry is kept. The form must be valid.
+func (form *snippetCreateForm) expiry(now time.Time) time.Time {
+	if form.Expires == customExpiry {
+		expiresAt, _ := time.Parse(expiresAtLayout, form.ExpiresAt)
+		return expiresAt
+	}
+
+	opt, ok := findExpiryOption(form.Expires)
+	if !ok || opt.add == nil {
+		return time.Time{}
+	}
+	return opt.add(now.UTC())
+}
+
+// Returns the snippet the form describes, with the given ID and owner. Burn after reading
+// snippets are never public, since listing them would let anyone burn them.
+func (form *snippetCreateForm) snippet(id, userID int) *models.Snippet {
+	visibility := form.Visibility
+	if form.BurnAfterReading && visibility == models.VisibilityPublic {
+		visibility = models.VisibilityUnlisted
+	}
+
+	return &models.Snippet{
+		ID:               id,
+		UserID:           userID,
+		Title:            form.Title,
+		Content:          form.Content,
+		Language:         form.language(),
+		Visibility:       visibility,
+		Expires:          form.expiry(time.Now()),
+		KeepExpires:      form.Expires == keepExpiry,
+		BurnAfterReading: form.BurnAfterReading,
+		Passphrase:       form.Passphrase,
+	}
+}
+
+type snippetUnlockForm struct {
+	Passphrase          string `form:"passphrase"`
+	validator.Validator `form:"-"`
+}
+
+type snippetRestoreForm struct {
+	Revision int `form:"revision"`
+}
+
+type tokenCreateForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
 	validator.Validator `form:"-"`
 }
 
@@ -31,6 +176,17 @@ type userLoginForm struct {
 	validator.Validator `form:"-"`
 }
 
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type passwordResetForm struct {
+	Token               string `form:"token"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	_, err := w.Write([]byte("OK"))
 	if err != nil {
@@ -42,42 +198,281 @@ func ping(w http.ResponseWriter, r *http.Request) {
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	s, err := app.snippets.Latest()
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 	// for _, snippet := range s {
 	// 	fmt.Fprintf(w, "%v\n", snippet)
 	// }
 
+	cloud, err := app.tags.Cloud(30)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippets = s
+	data.TagCloud = cloud
+
+	app.render(w, r, http.StatusOK, "home.tmpl.html", data)
+}
+
+// Lists all unexpired snippets a page at a time. Takes optional sort, author, limit and cursor
+// query parameters.
+func (app *application) snippetList(w http.ResponseWriter, r *http.Request) {
+	opts, err := readListOptions(r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	opts.ViewerID = app.authenticatedUserID(r)
+
+	page, err := app.snippets.List(opts)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = page.Snippets
+	data.Listing = &snippetListing{
+		Sort:     opts.Sort,
+		AuthorID: opts.AuthorID,
+		Next:     listingURL(opts, page.Next),
+		Prev:     listingURL(opts, page.Prev),
+	}
+
+	app.render(w, r, http.StatusOK, "list.tmpl.html", data)
+}
+
+// Searches snippet titles and content for the q query parameter. An empty query just shows the
+// search form.
+func (app *application) snippetSearch(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	query := strings.TrimSpace(qs.Get("q"))
+
+	data := app.newTemplateData(r)
+	data.Search = &searchResults{Query: query}
+
+	if query == "" {
+		app.render(w, r, http.StatusOK, "search.tmpl.html", data)
+		return
+	}
 
-	app.render(w, http.StatusOK, "home.tmpl.html", data)
+	if !validator.MaxChars(query, 200) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	page, err := app.snippets.Search(query, models.DefaultPageSize, qs.Get("cursor"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data.Snippets = page.Snippets
+	data.Search.Next = searchURL(query, page.Next)
+	data.Search.Prev = searchURL(query, page.Prev)
+
+	app.render(w, r, http.StatusOK, "search.tmpl.html", data)
 }
 
-// Add a viewSnippet handler function that receives an id query parameter
-// that must be an integer greater than or equal to 1.
+// Returns a handler redirecting one of the old numeric URLs, like /snippet/view/:id, to the
+// snippet's /s/:slug URL with suffix appended, keeping the query string. Only public snippets are
+// redirected, so counting through IDs can't turn up unlisted or private ones.
+func (app *application) snippetRedirectByID(suffix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := readIDParam(r)
+		if err != nil {
+			app.notFound(w)
+			return
+		}
+
+		s, err := app.snippets.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		if s.Visibility != models.VisibilityPublic {
+			app.notFound(w)
+			return
+		}
+
+		u := url.URL{Path: "/s/" + s.Slug + suffix, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	}
+}
+
+// Shows the snippet with the slug in the :slug route parameter. Viewing a burn after reading
+// snippet burns it, except for its owner, who is asked to confirm first so that following the
+// redirect after creating it doesn't.
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.Atoi(httprouter.Params.ByName(params, "id"))
-	if err != nil || id < 1 {
-		app.notFound(w)
+	s, ok := app.viewableSnippet(w, r)
+	if !ok {
 		return
 	}
 
-	s, err := app.snippets.Get(id)
-	if err == models.ErrNoRecord {
-		app.notFound(w)
+	if s.BurnAfterReading {
+		if s.UserID == app.authenticatedUserID(r) {
+			data := app.newTemplateData(r)
+			data.Snippet = s
+			app.render(w, r, http.StatusOK, "burn.tmpl.html", data)
+			return
+		}
+
+		s, ok = app.consumeSnippet(w, r, s)
+		if !ok {
+			return
+		}
+	}
+
+	app.renderSnippet(w, r, s)
+}
+
+// Burns the owner's own burn after reading snippet once they've confirmed they want to read it.
+// Only reachable through requireSnippetOwner.
+func (app *application) snippetBurnPost(w http.ResponseWriter, r *http.Request) {
+	s := app.contextSnippet(r)
+	if !s.BurnAfterReading {
+		app.clientError(w, http.StatusBadRequest)
 		return
-	} else if err != nil {
-		app.serverError(w, err)
+	}
+
+	s, ok := app.consumeSnippet(w, r, s)
+	if !ok {
+		return
+	}
+
+	app.renderSnippet(w, r, s)
+}
+
+// Renders the view page for a snippet
+func (app *application) renderSnippet(w http.ResponseWriter, r *http.Request, s *models.Snippet) {
+	tags, err := app.tags.ForSnippet(s.ID)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
 	data := app.newTemplateData(r)
 	data.Snippet = s
+	data.SnippetTags = tags
+
+	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+// Serves a snippet's content as plain text, for piping into shells and editors. Burns burn after
+// reading snippets like the view page does, and sends their owner there to confirm first.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if s.BurnAfterReading {
+		if s.UserID == app.authenticatedUserID(r) {
+			app.confirmBurn(w, r, s)
+			return
+		}
+
+		s, ok = app.consumeSnippet(w, r, s)
+		if !ok {
+			return
+		}
+	}
+
+	app.serveSnippetContent(w, r, s)
+}
+
+// Serves a snippet's content as a file attachment named after its title and language
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if s.BurnAfterReading {
+		if s.UserID == app.authenticatedUserID(r) {
+			app.confirmBurn(w, r, s)
+			return
+		}
+
+		s, ok = app.consumeSnippet(w, r, s)
+		if !ok {
+			return
+		}
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": snippetFilename(s)}))
+
+	app.serveSnippetContent(w, r, s)
+}
+
+// Checks the passphrase for a protected snippet, and if it's right lets the user read the snippet
+// for the rest of their session. Each IP address gets its own allowance of guesses at each
+// snippet, so someone guessing wrong can't lock the snippet for everyone else. Unlock's own
+// lockout only kicks in after far more failures, from any number of addresses.
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.findSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if app.isUnlocked(r, s) {
+		http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
+		return
+	}
+
+	var form snippetUnlockForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-	app.render(w, http.StatusOK, "view.tmpl.html", data)
+	form.CheckField(validator.NotBlank(form.Passphrase), "passphrase", "This field cannot be blank")
+
+	status := http.StatusUnprocessableEntity
+	if form.Valid() {
+		err = app.allowPassphraseGuess(w, r, s.ID)
+		if err == nil {
+			err = app.snippets.Unlock(s.ID, form.Passphrase)
+		}
+		if err == nil {
+			app.rememberUnlocked(r, s.ID)
+			http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
+			return
+		}
+
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddNonFieldError("The passphrase is incorrect")
+		} else if errors.Is(err, models.ErrTooManyAttempts) {
+			status = http.StatusTooManyRequests
+			form.AddNonFieldError("Too many wrong passphrases, please try again later")
+		} else {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = s
+	data.Form = form
+	app.render(w, r, status, "unlock.tmpl.html", data)
 }
 
 // Add a snippetCreate handler function to show snippet creation form.
@@ -88,10 +483,11 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	// Notice how this is also a great opportunity to set any default or
 	// 'initial' values for the form.
 	data.Form = snippetCreateForm{
-		Expires: 365,
+		Visibility: models.VisibilityPublic,
+		Expires:    "1y",
 	}
 
-	app.render(w, http.StatusOK, "create.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
 }
 
 // Add a snippetCreatePost to POST snippet.
@@ -103,26 +499,19 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Check each value:
-	// - title is not blank and not more than 100 chars long
-	// - content is not blank
-	// - expires value matches one of 1, 7, or 365
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.ValidValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7, or 365")
+	form.validate()
 
 	// Show errors on create snippet form if validation fails
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	s, err := app.createSnippet(form, app.authenticatedUserID(r))
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -130,13 +519,228 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	// If there is no existing session / session has expired, a new empty session will be auto-created
 	app.sessionManager.Put(r.Context(), "toast", "Snippet successfully created!")
 
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
+}
+
+// Shows the snippet form pre-filled with the snippet's current title and content. Only reachable
+// through requireSnippetOwner, which has already loaded the snippet.
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	s := app.contextSnippet(r)
+
+	tags, err := app.tags.ForSnippet(s.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = s
+	form := snippetCreateForm{
+		Title:      s.Title,
+		Content:    s.Content,
+		Language:   s.Language,
+		Visibility: s.Visibility,
+		Tags:       strings.Join(tags, ", "),
+	}
+
+	// Keep the snippet's expiry unless it's changed. It's left as it is rather than sent back
+	// through expires_at, which only goes down to the minute.
+	if s.Expires.IsZero() {
+		form.Expires = "never"
+	} else {
+		form.Expires = keepExpiry
+	}
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "edit.tmpl.html", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	s := app.contextSnippet(r)
+
+	form := snippetCreateForm{editing: true}
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = s
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.tmpl.html", data)
+		return
+	}
+
+	// Whether a snippet burns after reading is fixed when it's created
+	form.BurnAfterReading = s.BurnAfterReading
+
+	err = app.snippets.Save(form.snippet(s.ID, s.UserID), app.authenticatedUserID(r), parseTags(form.Tags))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "toast", "Snippet successfully updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
+}
+
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	s := app.contextSnippet(r)
+
+	err := app.snippets.Delete(s.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "toast", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Lists the latest unexpired snippets carrying a tag
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	tag := httprouter.ParamsFromContext(r.Context()).ByName("tag")
+	if !validator.Matches(tag, validator.TagRX) || !validator.MaxChars(tag, 30) {
+		app.notFound(w)
+		return
+	}
+
+	snippets, err := app.tags.Snippets(tag, models.MaxPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tag = tag
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "tag.tmpl.html", data)
+}
+
+// Lists every revision of a snippet newest first, with a form to pick any two of them to diff,
+// starting out on the latest and the one before it
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Old revisions would give away the content without burning it
+	if s.BurnAfterReading && s.UserID != app.authenticatedUserID(r) {
+		app.notFound(w)
+		return
+	}
+
+	revisions, err := app.revisions.List(s.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = s
+	data.Revisions = revisions
+
+	app.render(w, r, http.StatusOK, "history.tmpl.html", data)
+}
+
+// Shows a unified diff between the revisions given in the from and to query parameters
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if s.BurnAfterReading && s.UserID != app.authenticatedUserID(r) {
+		app.notFound(w)
+		return
+	}
+
+	fromID, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	toID, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	from, err := app.revisions.Get(s.ID, fromID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	to, err := app.revisions.Get(s.ID, toID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = s
+	data.Diff = &revisionDiff{
+		From:  from,
+		To:    to,
+		Hunks: diff.Unified(from.Content, to.Content, 3),
+	}
+
+	app.render(w, r, http.StatusOK, "diff.tmpl.html", data)
+}
+
+// Makes an old revision the snippet's current content. Only reachable through
+// requireSnippetOwner.
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	s := app.contextSnippet(r)
+
+	var form snippetRestoreForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.revisions.Restore(s.ID, form.Revision, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "toast", fmt.Sprintf("Snippet restored to revision #%d!", form.Revision))
+
+	http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
 }
 
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userSignupForm{}
-	app.render(w, http.StatusOK, "signup.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "signup.tmpl.html", data)
 }
 
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
@@ -156,7 +760,7 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
 		return
 	}
 
@@ -167,9 +771,9 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 			form.AddFieldError("email", "Email address is already in use")
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
@@ -183,7 +787,7 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "login.tmpl.html", data)
 }
 
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
@@ -201,20 +805,28 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
 		return
 	}
 
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	id, err := app.users.Authenticate(form.Email, form.Password, app.clientIP(r))
 	if err != nil {
+		status := http.StatusUnprocessableEntity
+
+		var lockout *models.LockoutError
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			form.AddNonFieldError("Email or password is incorrect")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		} else if errors.As(err, &lockout) {
+			status = http.StatusTooManyRequests
+			form.AddNonFieldError(fmt.Sprintf("Too many failed attempts to log in, please try again %s", countdown(lockout.Until)))
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
+			return
 		}
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, status, "login.tmpl.html", data)
 		return
 	}
 
@@ -222,12 +834,20 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	// It will still retain any data associated with the session
 	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+
+	version, err := app.users.SessionVersion(id)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	// Add current user ID to indicate that they are logged in
+	// Add current user ID to indicate that they are logged in, and the session version the login
+	// is good for
 	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	app.sessionManager.Put(r.Context(), "sessionVersion", version)
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -235,13 +855,180 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	err := app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "sessionVersion")
 
 	app.sessionManager.Put(r.Context(), "toast", "You've been logged out successfully!")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+func (app *application) userPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordForgotForm{}
+	app.render(w, r, http.StatusOK, "forgot.tmpl.html", data)
+}
+
+func (app *application) userPasswordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "forgot.tmpl.html", data)
+		return
+	}
+
+	// Looked up and sent in the background, so the response is the same, and as quick, whether or
+	// not there's an account with the email
+	logger := app.requestLogger(r)
+	app.background(func() {
+		app.sendPasswordReset(logger, form.Email)
+	})
+
+	app.sessionManager.Put(r.Context(), "toast", "If there's an account with that email, we've sent it a link to reset your password.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Shows the form to choose a new password, if the token in the link is still good
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	err := app.passwordResets.Check(token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.invalidPasswordReset(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = passwordResetForm{Token: token}
+	app.render(w, r, http.StatusOK, "reset.tmpl.html", data)
+}
+
+func (app *application) userPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordResetForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "reset.tmpl.html", data)
+		return
+	}
+
+	// Every session and personal access token the user had stops working too
+	_, err = app.users.ResetPassword(form.Token, form.Password, app.clientIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.invalidPasswordReset(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "toast", "Your password has been reset. Please log in.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Sends someone whose reset link doesn't work back to ask for another
+func (app *application) invalidPasswordReset(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "toast", "That password reset link is invalid or has expired, please ask for another.")
+	http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+}
+
+// Lists the user's personal access tokens alongside the form to create a new one
+func (app *application) userTokens(w http.ResponseWriter, r *http.Request) {
+	// A token created by the request that redirected here, taken out of the session so it's only
+	// ever shown once
+	var newToken *models.Token
+	if plaintext := app.sessionManager.PopString(r.Context(), "newTokenPlaintext"); plaintext != "" {
+		newToken = &models.Token{
+			Name:      app.sessionManager.PopString(r.Context(), "newTokenName"),
+			Plaintext: plaintext,
+		}
+	}
+
+	app.renderTokens(w, r, http.StatusOK, tokenCreateForm{Scopes: []string{models.ScopeRead}}, newToken)
+}
+
+func (app *application) userTokensPost(w http.ResponseWriter, r *http.Request) {
+	var form tokenCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(len(form.Scopes) > 0, "scopes", "Choose at least one scope")
+	for _, scope := range form.Scopes {
+		form.CheckField(validator.ValidValue(scope, models.ScopeRead, models.ScopeWrite), "scopes", "This field must be read or write")
+	}
+
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form, nil)
+		return
+	}
+
+	token, err := app.tokens.Insert(app.authenticatedUserID(r), form.Name, form.Scopes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The plaintext is never stored with the token, so it's passed through the session for
+	// userTokens to show once. Redirecting means refreshing the page doesn't create another token.
+	app.sessionManager.Put(r.Context(), "newTokenName", token.Name)
+	app.sessionManager.Put(r.Context(), "newTokenPlaintext", token.Plaintext)
+
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
+func (app *application) userTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	err = app.tokens.Revoke(app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "toast", "Token revoked!")
+
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mhrdini/snippetbox/internal/assert"
+	"github.com/mhrdini/snippetbox/internal/mailer"
 	"github.com/mhrdini/snippetbox/internal/models/mocks"
 )
 
@@ -38,44 +41,38 @@ func TestSnippetView(t *testing.T) {
 		want result
 	}{
 		{
-			name: "Valid ID",
-			path: "/snippet/view/1",
+			name: "Valid slug",
+			path: "/s/" + mocks.MockSnippet.Slug,
 			want: result{
 				status: http.StatusOK,
-				body:   mocks.MockSnippet.Content,
+				body:   `<span class="line" id="L1"><a class="ln" href="#L1">1</a>` + mocks.MockSnippet.Content + `</span>`,
 			},
 		},
 		{
-			name: "Non-existent ID",
-			path: "/snippet/view/2",
+			name: "Titled by snippet title",
+			path: "/s/" + mocks.MockSnippet.Slug,
 			want: result{
-				status: http.StatusNotFound,
-			},
-		},
-		{
-			name: "Negative ID",
-			path: "/snippet/view/-1",
-			want: result{
-				status: http.StatusNotFound,
+				status: http.StatusOK,
+				body:   "<title>" + mocks.MockSnippet.Title + " - Snippetbox</title>",
 			},
 		},
 		{
-			name: "Decimal ID",
-			path: "/snippet/view/1.23",
+			name: "Non-existent slug",
+			path: "/s/N0Sn1ppetX",
 			want: result{
 				status: http.StatusNotFound,
 			},
 		},
 		{
-			name: "String ID",
-			path: "/snippet/view/foo",
+			name: "Too short slug",
+			path: "/s/P0nd",
 			want: result{
 				status: http.StatusNotFound,
 			},
 		},
 		{
-			name: "Empty ID",
-			path: "/snippet/view/",
+			name: "Slug with invalid characters",
+			path: "/s/P0nd-ilent",
 			want: result{
 				status: http.StatusNotFound,
 			},
@@ -189,3 +186,1109 @@ func TestUserSignup(t *testing.T) {
 	}
 
 }
+
+func TestUserLoginPost(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		email      string
+		password   string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Wrong password",
+			email:      mocks.ValidEmail,
+			password:   "wrong password",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "Email or password is incorrect",
+		},
+		{
+			name:       "Locked out",
+			email:      mocks.LockedEmail,
+			password:   mocks.ValidPassword,
+			wantStatus: http.StatusTooManyRequests,
+			wantBody:   "Too many failed attempts to log in, please try again in 9 minutes",
+		},
+		{
+			name:       "Valid credentials",
+			email:      mocks.ValidEmail,
+			password:   mocks.ValidPassword,
+			wantStatus: http.StatusSeeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", csrfToken)
+
+			status, _, body := ts.postForm(t, "/user/login", form)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserPasswordForgotPost(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		wantStatus int
+		wantMail   bool
+	}{
+		{
+			name:       "Account",
+			email:      mocks.ValidEmail,
+			wantStatus: http.StatusSeeOther,
+			wantMail:   true,
+		},
+		{
+			name:       "No account",
+			email:      "nobody@example.com",
+			wantStatus: http.StatusSeeOther,
+		},
+		{
+			name:       "Invalid email",
+			email:      "nobody",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/password/forgot")
+			csrfToken := extractCSRFToken(t, body)
+
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", csrfToken)
+
+			status, header, _ := ts.postForm(t, "/user/password/forgot", form)
+			assert.Equal(t, status, tt.wantStatus)
+			if status == http.StatusSeeOther {
+				assert.Equal(t, header.Get("Location"), "/user/login")
+			}
+
+			// The email is sent in the background
+			app.wg.Wait()
+			messages := app.mailer.(*mailer.Outbox).Messages()
+			if !tt.wantMail {
+				assert.Equal(t, len(messages), 0)
+				return
+			}
+
+			assert.Equal(t, len(messages), 1)
+			assert.Equal(t, messages[0].To, `"Astarion Ancunin" <lilstar@bg3.com>`)
+			assert.StringContains(t, messages[0].Body, "https://snippetbox.test/user/password/reset?token="+mocks.ValidResetToken)
+		})
+	}
+}
+
+func TestUserPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	status, _, body := ts.get(t, "/user/password/reset?token="+mocks.ValidResetToken)
+	assert.Equal(t, status, http.StatusOK)
+	assert.StringContains(t, body, `<input type="hidden" name="token" value="`+mocks.ValidResetToken+`" />`)
+	csrfToken := extractCSRFToken(t, body)
+
+	status, header, _ := ts.get(t, "/user/password/reset?token=expired")
+	assert.Equal(t, status, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/password/forgot")
+
+	tests := []struct {
+		name         string
+		token        string
+		password     string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:       "Short password",
+			token:      mocks.ValidResetToken,
+			password:   "short",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "This field must be at least 8 characters",
+		},
+		{
+			name:         "Invalid token",
+			token:        "expired",
+			password:     "a new password",
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/user/password/forgot",
+		},
+		{
+			name:         "Valid",
+			token:        mocks.ValidResetToken,
+			password:     "a new password",
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("token", tt.token)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", csrfToken)
+
+			status, header, body := ts.postForm(t, "/user/password/reset", form)
+
+			assert.Equal(t, status, tt.wantStatus)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetEdit(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		status, header, _ := ts.get(t, "/s/"+mocks.MockSnippet.Slug+"/edit")
+
+		assert.Equal(t, status, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	ts.login(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Owner",
+			path:       "/s/" + mocks.MockSnippet.Slug + "/edit",
+			wantStatus: http.StatusOK,
+			wantBody:   `<form action="/s/` + mocks.MockSnippet.Slug + `/edit" method="POST">`,
+		},
+		{
+			name:       "Not owner",
+			path:       "/s/" + mocks.MockOtherSnippet.Slug + "/edit",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Non-existent ID",
+			path:       "/s/N0Sn1ppetX/edit",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetEditPostExpiry(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	// The edit form starts out keeping the snippet's expiry
+	_, _, body := ts.get(t, "/s/"+mocks.MockSnippet.Slug+"/edit")
+	assert.StringContains(t, body, `<option value="keep" selected>`)
+
+	tests := []struct {
+		name       string
+		path       string
+		expires    string
+		expiresAt  string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			// Even though MockSnippet expires about now, so a custom expiry of the same time would fail
+			name:       "Keep",
+			path:       "/s/" + mocks.MockSnippet.Slug + "/edit",
+			expires:    "keep",
+			wantStatus: http.StatusSeeOther,
+		},
+		{
+			name:       "Custom in the past",
+			path:       "/s/" + mocks.MockSnippet.Slug + "/edit",
+			expires:    "custom",
+			expiresAt:  time.Now().UTC().Add(-time.Hour).Format(expiresAtLayout),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "This field must be in the future",
+		},
+		{
+			name:       "Keep when creating",
+			path:       "/snippet/create",
+			expires:    "keep",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "This field must equal 10m, 1h, 1d, 1w, 1mo, 1y, never or custom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "An old silent pond")
+			form.Add("content", "An old silent pond...")
+			form.Add("visibility", "public")
+			form.Add("expires", tt.expires)
+			form.Add("expires_at", tt.expiresAt)
+			form.Add("csrf_token", csrfToken)
+
+			status, _, body := ts.postForm(t, tt.path, form)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetDeletePost(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "Owner", path: "/s/" + mocks.MockSnippet.Slug + "/delete", wantStatus: http.StatusSeeOther},
+		{name: "Not owner", path: "/s/" + mocks.MockOtherSnippet.Slug + "/delete", wantStatus: http.StatusForbidden},
+		{name: "Non-existent ID", path: "/s/N0Sn1ppetX/delete", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			status, _, _ := ts.postForm(t, tt.path, form)
+
+			assert.Equal(t, status, tt.wantStatus)
+		})
+	}
+}
+
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "History",
+			path:       "/s/" + mocks.MockSnippet.Slug + "/history",
+			wantStatus: http.StatusOK,
+			wantBody:   `<option value="1" selected>`,
+		},
+		{
+			name:       "History of non-existent snippet",
+			path:       "/s/N0Sn1ppetX/history",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Diff",
+			path:       "/s/" + mocks.MockSnippet.Slug + "/diff?from=1&to=2",
+			wantStatus: http.StatusOK,
+			wantBody:   `<span class="del">-An old pond...</span>`,
+		},
+		{
+			name:       "Diff with revision of another snippet",
+			path:       "/s/" + mocks.MockOtherSnippet.Slug + "/diff?from=1&to=2",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Diff without revisions",
+			path:       "/s/" + mocks.MockSnippet.Slug + "/diff",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetRestorePost(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		revision   string
+		wantStatus int
+	}{
+		{name: "Valid revision", path: "/s/" + mocks.MockSnippet.Slug + "/restore", revision: "1", wantStatus: http.StatusSeeOther},
+		{name: "Non-existent revision", path: "/s/" + mocks.MockSnippet.Slug + "/restore", revision: "9", wantStatus: http.StatusNotFound},
+		{name: "Not owner", path: "/s/" + mocks.MockOtherSnippet.Slug + "/restore", revision: "1", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("revision", tt.revision)
+			form.Add("csrf_token", csrfToken)
+
+			status, _, _ := ts.postForm(t, tt.path, form)
+
+			assert.Equal(t, status, tt.wantStatus)
+		})
+	}
+}
+
+func TestSnippetList(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Default",
+			path:       "/snippets",
+			wantStatus: http.StatusOK,
+			wantBody:   mocks.MockOtherSnippet.Title,
+		},
+		{
+			name:       "By author",
+			path:       "/snippets?sort=oldest&author=1",
+			wantStatus: http.StatusOK,
+			wantBody:   mocks.MockSnippet.Title,
+		},
+		{
+			name:       "First page",
+			path:       "/snippets?limit=1",
+			wantStatus: http.StatusOK,
+			wantBody:   `<a class="next" href="/snippets?cursor=1&amp;limit=1&amp;sort=newest">`,
+		},
+		{
+			name:       "Next page",
+			path:       "/snippets?limit=1&cursor=1",
+			wantStatus: http.StatusOK,
+			wantBody:   `<a class="prev" href="/snippets?cursor=0&amp;limit=1&amp;sort=newest">`,
+		},
+		{
+			name:       "Invalid cursor",
+			path:       "/snippets?cursor=foo",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown sort",
+			path:       "/snippets?sort=random",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Limit too large",
+			path:       "/snippets?limit=1000",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid author",
+			path:       "/snippets?author=foo",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetSearch(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Empty query",
+			path:       "/search",
+			wantStatus: http.StatusOK,
+			wantBody:   `<form action="/search" method="GET">`,
+		},
+		{
+			name:       "Match",
+			path:       "/search?q=silent",
+			wantStatus: http.StatusOK,
+			wantBody:   "An old <mark>silent</mark> pond",
+		},
+		{
+			name:       "No match",
+			path:       "/search?q=frog",
+			wantStatus: http.StatusOK,
+			wantBody:   "No snippets match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestUserTokens(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	t.Run("List", func(t *testing.T) {
+		status, _, body := ts.get(t, "/user/tokens")
+
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, mocks.MockToken.Name)
+	})
+
+	tests := []struct {
+		name       string
+		tokenName  string
+		scopes     []string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Valid",
+			tokenName:  "CI",
+			scopes:     []string{"read", "write"},
+			wantStatus: http.StatusSeeOther,
+		},
+		{
+			name:       "No scopes",
+			tokenName:  "CI",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "Choose at least one scope",
+		},
+		{
+			name:       "Unknown scope",
+			tokenName:  "CI",
+			scopes:     []string{"admin"},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "This field must be read or write",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", tt.tokenName)
+			for _, scope := range tt.scopes {
+				form.Add("scopes", scope)
+			}
+			form.Add("csrf_token", csrfToken)
+
+			status, _, body := ts.postForm(t, "/user/tokens", form)
+
+			assert.Equal(t, status, tt.wantStatus)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	t.Run("New token shown once", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", "CI")
+		form.Add("scopes", "write")
+		form.Add("csrf_token", csrfToken)
+
+		status, header, _ := ts.postForm(t, "/user/tokens", form)
+		assert.Equal(t, status, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/tokens")
+
+		_, _, body := ts.get(t, "/user/tokens")
+		assert.StringContains(t, body, mocks.ValidWriteToken)
+
+		// Refreshing the page doesn't show it again
+		_, _, body = ts.get(t, "/user/tokens")
+		if strings.Contains(body, mocks.ValidWriteToken) {
+			t.Errorf("new token shown twice")
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+
+		status, _, _ := ts.postForm(t, "/user/tokens/1/revoke", form)
+		assert.Equal(t, status, http.StatusSeeOther)
+
+		status, _, _ = ts.postForm(t, "/user/tokens/9/revoke", form)
+		assert.Equal(t, status, http.StatusNotFound)
+	})
+}
+
+func TestTagView(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Tag with snippets",
+			path:       "/tags/haiku",
+			wantStatus: http.StatusOK,
+			wantBody:   mocks.MockSnippet.Title,
+		},
+		{
+			name:       "Tag without snippets",
+			path:       "/tags/golang",
+			wantStatus: http.StatusOK,
+			wantBody:   "There are no snippets with this tag.",
+		},
+		{
+			name:       "Invalid tag",
+			path:       "/tags/Not_A_Tag",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Chips on snippet view", func(t *testing.T) {
+		_, _, body := ts.get(t, "/s/"+mocks.MockSnippet.Slug)
+		assert.StringContains(t, body, `<a class="tag" href="/tags/haiku">haiku</a>`)
+	})
+
+	t.Run("Cloud on home page", func(t *testing.T) {
+		_, _, body := ts.get(t, "/")
+		assert.StringContains(t, body, `<a class="tag" href="/tags/poetry">poetry <span>1</span></a>`)
+	})
+}
+
+func TestSnippetCreatePostTags(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	tests := []struct {
+		name       string
+		tags       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Valid tags",
+			tags:       "Go, sql yaml, go",
+			wantStatus: http.StatusSeeOther,
+		},
+		{
+			name:       "Too many tags",
+			tags:       "a b c d e f",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot have more than 5 tags",
+		},
+		{
+			name:       "Invalid characters",
+			tags:       "go, c++",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "Tags can only contain lowercase letters, numbers and hyphens",
+		},
+		{
+			name:       "Too long",
+			tags:       strings.Repeat("a", 31),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "Tags cannot be more than 30 characters long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "An old silent pond")
+			form.Add("content", "An old silent pond...")
+			form.Add("visibility", "public")
+			form.Add("expires", "1w")
+			form.Add("tags", tt.tags)
+			form.Add("csrf_token", csrfToken)
+
+			status, _, body := ts.postForm(t, "/snippet/create", form)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		path            string
+		wantStatus      int
+		wantDisposition string
+	}{
+		{
+			name:       "Raw",
+			path:       "/s/" + mocks.MockSnippet.Slug + "/raw",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "Download",
+			path:            "/s/" + mocks.MockSnippet.Slug + "/download",
+			wantStatus:      http.StatusOK,
+			wantDisposition: `attachment; filename=an-old-silent-pond.txt`,
+		},
+		{
+			name:       "Non-existent ID",
+			path:       "/s/N0Sn1ppetX/raw",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Invalid ID",
+			path:       "/s/foo/download",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, body := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			if status != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, body, mocks.MockSnippet.Content)
+			assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+			assert.Equal(t, header.Get("Content-Disposition"), tt.wantDisposition)
+
+			// A client that already has this version gets a 304 with no body
+			etag := header.Get("ETag")
+			status, _, body = ts.do(t, http.MethodGet, tt.path, http.Header{"If-None-Match": {etag}}, "")
+			assert.Equal(t, status, http.StatusNotModified)
+			assert.Equal(t, body, "")
+
+			status, _, _ = ts.do(t, http.MethodGet, tt.path, http.Header{"If-None-Match": {`"stale"`}}, "")
+			assert.Equal(t, status, http.StatusOK)
+		})
+	}
+}
+
+func TestSnippetVisibility(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	paths := []string{
+		"/s/" + mocks.MockPrivateSnippet.Slug,
+		"/s/" + mocks.MockPrivateSnippet.Slug + "/raw",
+		"/s/" + mocks.MockPrivateSnippet.Slug + "/history",
+		"/api/v1/snippets/" + mocks.MockPrivateSnippet.Slug,
+	}
+
+	for _, path := range paths {
+		t.Run("Anonymous "+path, func(t *testing.T) {
+			status, _, _ := ts.get(t, path)
+			assert.Equal(t, status, http.StatusNotFound)
+		})
+	}
+
+	_, _, body := ts.get(t, "/snippets")
+	if strings.Contains(body, mocks.MockPrivateSnippet.Title) {
+		t.Errorf("private snippet listed to anonymous user")
+	}
+
+	ts.login(t)
+
+	for _, path := range paths {
+		t.Run("Owner "+path, func(t *testing.T) {
+			status, _, _ := ts.get(t, path)
+			assert.Equal(t, status, http.StatusOK)
+		})
+	}
+
+	t.Run("Owner listing", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippets")
+		assert.StringContains(t, body, mocks.MockPrivateSnippet.Title)
+	})
+
+	t.Run("Badge", func(t *testing.T) {
+		_, _, body := ts.get(t, "/s/"+mocks.MockPrivateSnippet.Slug)
+		assert.StringContains(t, body, `<em class="visibility">private</em>`)
+	})
+}
+
+func TestSnippetRedirectByID(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "Public snippet",
+			path:         "/snippet/view/1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/s/" + mocks.MockSnippet.Slug,
+		},
+		{
+			name:         "History",
+			path:         "/snippet/view/1/history",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/s/" + mocks.MockSnippet.Slug + "/history",
+		},
+		{
+			name:         "Diff",
+			path:         "/snippet/view/1/diff?from=1&to=2",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/s/" + mocks.MockSnippet.Slug + "/diff?from=1&to=2",
+		},
+		{
+			name:         "Raw",
+			path:         "/snippet/raw/1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/s/" + mocks.MockSnippet.Slug + "/raw",
+		},
+		{
+			name:         "Download",
+			path:         "/snippet/download/1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/s/" + mocks.MockSnippet.Slug + "/download",
+		},
+		{
+			name:         "Edit",
+			path:         "/snippet/edit/1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/s/" + mocks.MockSnippet.Slug + "/edit",
+		},
+		{
+			name:       "Private snippet",
+			path:       "/snippet/view/4",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Non-existent ID",
+			path:       "/snippet/view/2",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "String ID",
+			path:       "/snippet/view/foo",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Private snippet raw",
+			path:       "/snippet/raw/4",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, _ := ts.get(t, tt.path)
+
+			assert.Equal(t, status, tt.wantStatus)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestSnippetBurnAfterReading(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	burn := "/s/" + mocks.MockBurnSnippet.Slug
+	burned := "/s/" + mocks.MockBurnedSnippet.Slug
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "First read",
+			path:     burn,
+			wantCode: http.StatusOK,
+			wantBody: mocks.MockBurnSnippet.Content,
+		},
+		{
+			name:     "Raw first read",
+			path:     burn + "/raw",
+			wantCode: http.StatusOK,
+			wantBody: mocks.MockBurnSnippet.Content,
+		},
+		{
+			name:     "History before reading",
+			path:     burn + "/history",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Already burned",
+			path:     burned,
+			wantCode: http.StatusGone,
+			wantBody: "This snippet is gone",
+		},
+		{
+			name:     "Raw already burned",
+			path:     burned + "/raw",
+			wantCode: http.StatusGone,
+		},
+		{
+			name:     "API already burned",
+			path:     "/api/v1/snippets/" + mocks.MockBurnedSnippet.Slug,
+			wantCode: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.path)
+			assert.Equal(t, status, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	csrfToken := ts.login(t)
+
+	t.Run("Owner sees interstitial", func(t *testing.T) {
+		status, _, body := ts.get(t, burn)
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, "Read and burn it")
+		if strings.Contains(body, mocks.MockBurnSnippet.Content) {
+			t.Errorf("interstitial shows the snippet's content")
+		}
+	})
+
+	for _, p := range []string{burn + "/raw", burn + "/download"} {
+		t.Run("Owner redirected from "+p, func(t *testing.T) {
+			status, header, body := ts.get(t, p)
+			assert.Equal(t, status, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), burn)
+			if strings.Contains(body, mocks.MockBurnSnippet.Content) {
+				t.Errorf("redirect shows the snippet's content")
+			}
+		})
+	}
+
+	t.Run("Owner confirms", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+
+		status, _, body := ts.postForm(t, burn+"/burn", form)
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, mocks.MockBurnSnippet.Content)
+	})
+}
+
+func TestSnippetUnlock(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	path := "/s/" + mocks.MockProtectedSnippet.Slug
+
+	for _, p := range []string{path, path + "/raw", path + "/history"} {
+		t.Run("Locked "+p, func(t *testing.T) {
+			status, _, body := ts.get(t, p)
+			assert.Equal(t, status, http.StatusForbidden)
+			assert.StringContains(t, body, "protected by a passphrase")
+			if strings.Contains(body, mocks.MockProtectedSnippet.Content) {
+				t.Errorf("locked snippet's content shown")
+			}
+		})
+	}
+
+	_, _, body := ts.get(t, path)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		passphrase   string
+		wantCode     int
+		wantBody     string
+		wantLocation string
+	}{
+		{
+			name:       "Blank passphrase",
+			passphrase: "",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot be blank",
+		},
+		{
+			name:       "Wrong passphrase",
+			passphrase: "wrong",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "The passphrase is incorrect",
+		},
+		{
+			name:       "Throttled",
+			passphrase: mocks.MockThrottledPassphrase,
+			wantCode:   http.StatusTooManyRequests,
+			wantBody:   "Too many wrong passphrases",
+		},
+		{
+			name:         "Right passphrase",
+			passphrase:   mocks.MockPassphrase,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: path,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("passphrase", tt.passphrase)
+			form.Add("csrf_token", validCSRFToken)
+
+			status, header, body := ts.postForm(t, path+"/unlock", form)
+			assert.Equal(t, status, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Unlocked", func(t *testing.T) {
+		status, _, body := ts.get(t, path)
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, mocks.MockProtectedSnippet.Content)
+	})
+
+	t.Run("API shares the session", func(t *testing.T) {
+		status, _, _ := ts.get(t, "/api/v1/snippets/"+mocks.MockProtectedSnippet.Slug)
+		assert.Equal(t, status, http.StatusOK)
+	})
+}
+
+func TestSnippetUnlockThrottledPerClient(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimiters.passphrase = newRateLimiter(rateLimitPolicy{name: "passphrase", rate: 1.0 / 60, burst: 1})
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	path := "/s/" + mocks.MockProtectedSnippet.Slug
+	_, _, body := ts.get(t, path)
+
+	form := url.Values{}
+	form.Add("passphrase", "wrong")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	status, _, _ := ts.postForm(t, path+"/unlock", form)
+	assert.Equal(t, status, http.StatusUnprocessableEntity)
+
+	// Turned away before the passphrase is checked, even the right one
+	form.Set("passphrase", mocks.MockPassphrase)
+	status, header, body := ts.postForm(t, path+"/unlock", form)
+	assert.Equal(t, status, http.StatusTooManyRequests)
+	assert.Equal(t, header.Get("Retry-After"), "60")
+	assert.StringContains(t, body, "Too many wrong passphrases")
+}
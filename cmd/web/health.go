@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// How long /readyz gives its checks altogether before reporting them as failed
+const readinessTimeout = 2 * time.Second
+
+// healthCheck is one of the dependencies /readyz checks, which fails if check returns an error
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// checkResult is what /readyz says about a check. Why a check failed is only logged, since errors
+// from drivers give away internal addresses and the probe is public.
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Liveness probe, responding as long as the process can serve requests at all. It deliberately
+// checks nothing else, so a database outage doesn't get the server restarted.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, envelope{"status": "ok"}, nil)
+}
+
+// Readiness probe, responding 200 only if every dependency is reachable and the server isn't
+// shutting down, with each check's status and latency. Load balancers stop sending traffic while
+// it responds 503.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	if app.shuttingDown.Load() {
+		app.writeJSON(w, http.StatusServiceUnavailable, envelope{"status": "shutting down"}, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	results := make(map[string]checkResult, len(app.healthChecks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	// Run concurrently so one slow dependency doesn't eat into the others' time
+	for _, hc := range app.healthChecks {
+		wg.Add(1)
+		go func(hc healthCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := hc.check(ctx)
+			result := checkResult{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = "failing"
+				app.logger.Error("readiness check failed", "check", hc.name, "error", err)
+			}
+
+			mu.Lock()
+			results[hc.name] = result
+			mu.Unlock()
+		}(hc)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "failing", http.StatusServiceUnavailable
+		}
+	}
+
+	app.writeJSON(w, code, envelope{"status": status, "checks": results}, nil)
+}
+
+// Checks the templates were parsed, which they always are unless the cache was built wrongly
+func (app *application) checkTemplates(ctx context.Context) error {
+	if len(app.templateCache) == 0 {
+		return errors.New("template cache is empty")
+	}
+	return nil
+}
+
+// Returns a check that looks a token up in a session store. The token doesn't exist, so a
+// reachable store finds nothing. Stores don't take a context, so the lookup is abandoned rather
+// than cancelled when ctx is done.
+func sessionStoreCheck(store scs.Store) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		errs := make(chan error, 1)
+		go func() {
+			_, _, err := store.Find("readiness-check")
+			errs <- err
+		}()
+
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
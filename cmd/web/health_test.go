@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/healthz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `"status": "ok"`)
+}
+
+func TestReadyz(t *testing.T) {
+	passing := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name         string
+		checks       []healthCheck
+		shuttingDown bool
+		wantCode     int
+		wantStatus   string
+		wantChecks   map[string]string
+	}{
+		{
+			name: "Ready",
+			checks: []healthCheck{
+				{name: "database", check: passing},
+				{name: "templates", check: passing},
+			},
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+			wantChecks: map[string]string{"database": "ok", "templates": "ok"},
+		},
+		{
+			name: "Failing dependency",
+			checks: []healthCheck{
+				{name: "database", check: failing},
+				{name: "templates", check: passing},
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "failing",
+			wantChecks: map[string]string{"database": "failing", "templates": "ok"},
+		},
+		{
+			name: "Shutting down",
+			checks: []healthCheck{
+				{name: "database", check: passing},
+			},
+			shuttingDown: true,
+			wantCode:     http.StatusServiceUnavailable,
+			wantStatus:   "shutting down",
+			wantChecks:   map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			var logs bytes.Buffer
+			app.logger = slog.New(slog.NewTextHandler(&logs, nil))
+			app.healthChecks = tt.checks
+			app.shuttingDown.Store(tt.shuttingDown)
+
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, _, body := ts.get(t, "/readyz")
+			assert.Equal(t, code, tt.wantCode)
+
+			var resp struct {
+				Status string                 `json:"status"`
+				Checks map[string]checkResult `json:"checks"`
+			}
+			err := json.Unmarshal([]byte(body), &resp)
+			assert.NilError(t, err)
+
+			assert.Equal(t, resp.Status, tt.wantStatus)
+			assert.Equal(t, len(resp.Checks), len(tt.wantChecks))
+			for name, want := range tt.wantChecks {
+				assert.Equal(t, resp.Checks[name].Status, want)
+			}
+			if tt.wantStatus == "failing" {
+				// The reason is only logged, never sent back
+				assert.Equal(t, strings.Contains(body, "connection refused"), false)
+				assert.StringContains(t, logs.String(), `msg="readiness check failed" check=database error="connection refused"`)
+			}
+		})
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	app := newTestApplication(t)
+	assert.NilError(t, app.checkTemplates(context.Background()))
+
+	app.templateCache = nil
+	assert.Equal(t, app.checkTemplates(context.Background()).Error(), "template cache is empty")
+
+	assert.NilError(t, sessionStoreCheck(memstore.New())(context.Background()))
+	assert.Equal(t, sessionStoreCheck(failingStore{})(context.Background()).Error(), "store is down")
+
+	// A store that doesn't answer in time is reported as failing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	blocked := make(chan struct{})
+	defer close(blocked)
+	err := sessionStoreCheck(blockingStore{unblock: blocked})(ctx)
+	assert.Equal(t, err, context.Canceled)
+}
+
+// Hangs on every lookup until unblocked
+type blockingStore struct {
+	failingStore
+	unblock chan struct{}
+}
+
+func (s blockingStore) Find(token string) ([]byte, bool, error) {
+	<-s.unblock
+	return nil, false, nil
+}
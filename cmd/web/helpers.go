@@ -2,24 +2,72 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/nosurf"
+	"github.com/mhrdini/snippetbox/internal/highlight"
+	"github.com/mhrdini/snippetbox/internal/models"
+	"github.com/mhrdini/snippetbox/internal/validator"
 )
 
-// Uses debug.Stack() function to get a stack trace for the current goroutine
-// and appends it to the log message. Set the frame depth to 2, making it report the file name and
-// line number one step back in the stack trace (instead of showing helpers.go because this was
-// where the error was called in)
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.errorLog.Output(2, trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+// Logs the error with a stack trace and sends the user a generic 500 Internal Server Error, so no
+// details of what went wrong reach them. The page gives the request's ID for them to quote when
+// reporting the problem, which finds the stack trace in the logs.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	message := http.StatusText(http.StatusInternalServerError)
+	if id := requestID(r); id != "" {
+		message += "\n\nPlease quote request ID " + id + " when reporting this problem."
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// Logs an error that happened while handling r, tagged with the same request ID and user as r's
+// line in the request log
+func (app *application) logError(r *http.Request, err error) {
+	logErrorTo(app.requestLogger(r), err)
+}
+
+// Returns the logger with the fields that tie a line to r in the request log already added. Work
+// carried on in the background takes this rather than r, which mustn't be used once the handler
+// has returned.
+func (app *application) requestLogger(r *http.Request) *slog.Logger {
+	return app.logger.With(
+		"request_id", requestID(r),
+		"method", r.Method,
+		"uri", r.URL.RequestURI(),
+		"user_id", requestFieldsFrom(r).userID,
+	)
+}
+
+// Logs an error to logger. debug.Stack() gets a stack trace for the current goroutine, which goes
+// in its own attribute so log pipelines keep it attached to the message.
+func logErrorTo(logger *slog.Logger, err error) {
+	logger.Error(err.Error(), "trace", string(debug.Stack()))
+}
+
+// Reports whether r came straight from one of the trusted reverse proxies, whose headers describing
+// the original request can be believed
+func (app *application) fromTrustedProxy(r *http.Request) bool {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return app.trustedProxies.contains(addrPort.Addr())
 }
 
 // Uses http.StatusText() to automaticaly generate a human-friendly text representation of a given
@@ -28,24 +76,49 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// Runs fn in a goroutine that shutdown waits for. A panic in fn is logged rather than taking the
+// whole server down, since recoverPanic only covers request handlers.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprint(err), "trace", string(debug.Stack()))
+			}
+		}()
+
+		fn()
+	}()
+}
+
 func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
 
+// Tells the reader that the burn after reading snippet they asked for has already been read
+func (app *application) gone(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusGone, "gone.tmpl.html", app.newTemplateData(r))
+}
+
 // Retrieve appropriate template from cache set based on page name, if not found then return server
 // error helper method.
-func (app *application) render(w http.ResponseWriter, status int, filename string, data *templateData) {
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, filename string, data *templateData) {
 
 	ts, ok := app.templateCache[filename]
 	if !ok {
-		app.serverError(w, fmt.Errorf("not found: template %s does not exist", filename))
+		app.serverError(w, r, fmt.Errorf("not found: template %s does not exist", filename))
 		return
 	}
 
 	buf := new(bytes.Buffer)
+	start := time.Now()
 	err := ts.ExecuteTemplate(buf, "base", data)
+	app.metrics.renderDuration.Observe(time.Since(start).Seconds(), filename)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -53,7 +126,7 @@ func (app *application) render(w http.ResponseWriter, status int, filename strin
 
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 }
@@ -62,10 +135,11 @@ func (app *application) render(w http.ResponseWriter, status int, filename strin
 // initialized with the current year.
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
-		CurrentYear:     time.Now().Year(),
-		Toast:           app.sessionManager.PopString(r.Context(), "toast"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		CurrentYear:         time.Now().Year(),
+		Toast:               app.sessionManager.PopString(r.Context(), "toast"),
+		IsAuthenticated:     app.isAuthenticated(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
+		CSRFToken:           nosurf.Token(r),
 	}
 }
 
@@ -106,3 +180,325 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	return isAuthenticated
 	// return app.sessionManager.Exists(r.Context(), "authenticatedUserID")
 }
+
+// Returns the ID stored in the request context by the authenticate middleware, or 0 if the
+// request isn't authenticated
+func (app *application) authenticatedUserID(r *http.Request) int {
+	id, ok := r.Context().Value(authenticatedUserIDContextKey).(int)
+	if !ok {
+		return 0
+	}
+	return id
+}
+
+// Returns the snippet shared by the requireSnippetOwner middleware. Panics if it's called from a
+// handler that isn't wrapped by that middleware, since that's a programming error.
+func (app *application) contextSnippet(r *http.Request) *models.Snippet {
+	s, ok := r.Context().Value(snippetContextKey).(*models.Snippet)
+	if !ok {
+		panic("contextSnippet called without requireSnippetOwner middleware")
+	}
+	return s
+}
+
+// Fetches the snippet named by the :slug route parameter for the pages that show it. Writes a
+// 404, 410 or 500 response and returns false if it can't be shown, or the passphrase prompt if
+// it's protected and hasn't been unlocked.
+func (app *application) viewableSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, ok := app.findSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !app.isUnlocked(r, s) {
+		data := app.newTemplateData(r)
+		data.Snippet = s
+		data.Form = snippetUnlockForm{}
+		app.render(w, r, http.StatusForbidden, "unlock.tmpl.html", data)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// Like viewableSnippet, but doesn't care whether a protected snippet has been unlocked
+func (app *application) findSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	slug, err := readSlugParam(r)
+	if err != nil {
+		app.notFound(w)
+		return nil, false
+	}
+
+	s, err := app.snippets.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Don't give away that a private snippet exists
+	if !s.VisibleTo(app.authenticatedUserID(r)) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	if s.Burned {
+		app.gone(w, r)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// Reports whether the current user may read a snippet's content. Anyone may read a snippet that
+// isn't protected, its owner always may, and anyone else once they've given the passphrase in
+// this session.
+func (app *application) isUnlocked(r *http.Request, s *models.Snippet) bool {
+	if !s.Protected || s.UserID == app.authenticatedUserID(r) {
+		return true
+	}
+
+	ids, _ := app.sessionManager.Get(r.Context(), "unlockedSnippetIDs").([]int)
+	for _, id := range ids {
+		if id == s.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Remembers in the session that the user gave the right passphrase for the snippet with this ID
+func (app *application) rememberUnlocked(r *http.Request, id int) {
+	ids, _ := app.sessionManager.Get(r.Context(), "unlockedSnippetIDs").([]int)
+	app.sessionManager.Put(r.Context(), "unlockedSnippetIDs", append(ids, id))
+}
+
+// Reads a burn after reading snippet, returning it as it was before it burned. Writes a 410 or
+// 500 response and returns false if someone else got there first.
+func (app *application) consumeSnippet(w http.ResponseWriter, r *http.Request, s *models.Snippet) (*models.Snippet, bool) {
+	s, err := app.snippets.Consume(s.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrGone) {
+			app.gone(w, r)
+		} else if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return s, true
+}
+
+// Sends the owner of a burn after reading snippet to its page to confirm they want to burn it,
+// rather than burning it from under them when they open its raw or download link
+func (app *application) confirmBurn(w http.ResponseWriter, r *http.Request, s *models.Snippet) {
+	http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
+}
+
+// Writes a snippet's content as plain text with no template. http.ServeContent answers
+// conditional requests against the ETag and Last-Modified headers with a 304, and handles ranges.
+func (app *application) serveSnippetContent(w http.ResponseWriter, r *http.Request, s *models.Snippet) {
+	// Browsers submit textarea newlines as CRLF, which shells don't appreciate
+	content := strings.ReplaceAll(s.Content, "\r\n", "\n")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", snippetETag(s, content))
+	// Caches may keep a copy but have to check it's still current before using it, and only the
+	// browser may keep a copy of a snippet that isn't public or is protected
+	if s.Visibility == models.VisibilityPublic && !s.Protected {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	http.ServeContent(w, r, "", s.Updated, strings.NewReader(content))
+}
+
+// Returns the ETag for a snippet served with the given content. The title and language are part
+// of it as well as the content, since downloads are named after them, so renaming a snippet
+// doesn't leave clients with a 304 and the old filename.
+func snippetETag(s *models.Snippet, content string) string {
+	h := sha256.New()
+	for _, field := range []string{s.Title, s.Language, content} {
+		// Each field is prefixed with its length, so moving text from one to the next changes the hash
+		fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+}
+
+// Returns the name to download a snippet as, made from its title and its language's extension,
+// e.g. "an-old-silent-pond.txt"
+func snippetFilename(s *models.Snippet) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s.Title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+		if b.Len() >= 50 {
+			break
+		}
+	}
+
+	name := b.String()
+	if name == "" {
+		name = fmt.Sprintf("snippet-%d", s.ID)
+	}
+
+	ext := ".txt"
+	if l, ok := highlight.Find(s.Language); ok {
+		ext = l.Ext
+	}
+
+	return name + ext
+}
+
+// Reads the :id route parameter, returning an error if it isn't a positive integer
+func readIDParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+// Reads the :slug route parameter, returning an error if it can't be a slug
+func readSlugParam(r *http.Request) (string, error) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+	if !models.ValidSlug(slug) {
+		return "", errors.New("invalid slug parameter")
+	}
+
+	return slug, nil
+}
+
+// Returns the /snippets URL for the page at cursor, keeping the rest of the listing options.
+// Returns an empty string if there is no such page.
+func listingURL(opts models.ListOptions, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+
+	qs := url.Values{}
+	qs.Set("sort", opts.Sort)
+	if opts.AuthorID != 0 {
+		qs.Set("author", strconv.Itoa(opts.AuthorID))
+	}
+	if opts.Limit != 0 {
+		qs.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	qs.Set("cursor", cursor)
+
+	return "/snippets?" + qs.Encode()
+}
+
+// Returns the /search URL for the result page at cursor, or an empty string if there is no such
+// page
+func searchURL(query, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+
+	qs := url.Values{}
+	qs.Set("q", query)
+	qs.Set("cursor", cursor)
+
+	return "/search?" + qs.Encode()
+}
+
+// Reads the sort, author, limit and cursor query parameters shared by the HTML and JSON snippet
+// listings
+func readListOptions(qs url.Values) (models.ListOptions, error) {
+	opts := models.ListOptions{
+		Sort:   qs.Get("sort"),
+		Cursor: qs.Get("cursor"),
+	}
+
+	if opts.Sort == "" {
+		opts.Sort = models.SortNewest
+	}
+	if !validator.ValidValue(opts.Sort, models.SortNewest, models.SortOldest, models.SortExpiring) {
+		return opts, errors.New("invalid sort parameter")
+	}
+
+	if author := qs.Get("author"); author != "" {
+		id, err := strconv.Atoi(author)
+		if err != nil || id < 1 {
+			return opts, errors.New("invalid author parameter")
+		}
+		opts.AuthorID = id
+	}
+
+	if limit := qs.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > models.MaxPageSize {
+			return opts, errors.New("invalid limit parameter")
+		}
+		opts.Limit = n
+	}
+
+	return opts, nil
+}
+
+// Inserts a validated snippet, recording it as the snippet's first revision and setting its tags.
+// Returns the new snippet, with its ID and slug set.
+func (app *application) createSnippet(form snippetCreateForm, userID int) (*models.Snippet, error) {
+	s := form.snippet(0, userID)
+
+	err := app.snippets.Save(s, userID, parseTags(form.Tags))
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Splits a tags form field on commas and whitespace into lowercase tags, dropping duplicates and
+// keeping the order they were typed in
+func parseTags(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range fields {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// Renders the token management page with the user's tokens, the create form and, straight after
+// creating one, the new token's plaintext
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form tokenCreateForm, newToken *models.Token) {
+	tokens, err := app.tokens.List(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Tokens = tokens
+	data.NewToken = newToken
+
+	app.render(w, r, status, "tokens.tmpl.html", data)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+func TestBackground(t *testing.T) {
+	app := newTestApplication(t)
+
+	var finished atomic.Int32
+
+	app.background(func() {
+		finished.Add(1)
+	})
+	// A panicking task is logged and still counts as finished
+	app.background(func() {
+		defer finished.Add(1)
+		panic("oops")
+	})
+
+	app.wg.Wait()
+
+	assert.Equal(t, finished.Load(), int32(2))
+}
+
+func TestSnippetETag(t *testing.T) {
+	s := &models.Snippet{Title: "An old silent pond", Language: "text", Content: "An old silent pond..."}
+	etag := snippetETag(s, s.Content)
+
+	tests := []struct {
+		name    string
+		snippet *models.Snippet
+		want    bool
+	}{
+		{
+			name:    "Same snippet",
+			snippet: &models.Snippet{Title: s.Title, Language: s.Language, Content: s.Content},
+			want:    true,
+		},
+		{
+			name:    "Content changed",
+			snippet: &models.Snippet{Title: s.Title, Language: s.Language, Content: "A frog jumps in"},
+		},
+		{
+			// The download's filename changes with the title
+			name:    "Renamed",
+			snippet: &models.Snippet{Title: "A frog jumps in", Language: s.Language, Content: s.Content},
+		},
+		{
+			name:    "Language changed",
+			snippet: &models.Snippet{Title: s.Title, Language: "go", Content: s.Content},
+		},
+		{
+			name:    "Text moved between fields",
+			snippet: &models.Snippet{Title: s.Title + "t", Language: "ext", Content: s.Content},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, snippetETag(tt.snippet, tt.snippet.Content) == etag, tt.want)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// How many rows the janitor deletes per statement, so no single DELETE holds its locks for long
+const janitorBatchSize = 500
+
+// How long login attempts are kept for, long enough to look back over an attack on an account
+const loginAttemptRetention = 30 * 24 * time.Hour
+
+// purger deletes up to limit rows that expired before a time, returning how many it deleted
+type purger interface {
+	DeleteExpired(before time.Time, limit int) (int, error)
+}
+
+// janitor periodically deletes the rows that queries already hide: snippets that expired or were
+// burned more than retention ago, expired sessions and password reset tokens, and login attempts
+// older than loginAttemptRetention
+type janitor struct {
+	snippets  purger
+	sessions  purger
+	logins    purger
+	resets    purger
+	interval  time.Duration
+	retention time.Duration
+	batchSize int
+	now       func() time.Time // the clock, swapped out in tests
+	newTicker tickerFunc       // starts the interval ticker, swapped out in tests
+	logger    *slog.Logger
+}
+
+// tickerFunc returns a channel that ticks every d and a func that stops the ticks
+type tickerFunc func(d time.Duration) (<-chan time.Time, func())
+
+// realTicker is a tickerFunc backed by a time.Ticker
+func realTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// run purges once every interval until ctx is cancelled. A purge that's under way when that
+// happens stops after its current batch.
+func (j *janitor) run(ctx context.Context) {
+	ticks, stop := j.newTicker(j.interval)
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			j.purge(ctx)
+		}
+	}
+}
+
+// purge deletes everything that's due in batches, logging how much went if anything did
+func (j *janitor) purge(ctx context.Context) {
+	now := j.now()
+
+	snippets, err := j.purgeAll(ctx, j.snippets, now.Add(-j.retention))
+	if err != nil {
+		j.logger.Error("janitor: purging snippets", "error", err)
+	}
+
+	sessions, err := j.purgeAll(ctx, j.sessions, now)
+	if err != nil {
+		j.logger.Error("janitor: purging sessions", "error", err)
+	}
+
+	logins, err := j.purgeAll(ctx, j.logins, now.Add(-loginAttemptRetention))
+	if err != nil {
+		j.logger.Error("janitor: purging login attempts", "error", err)
+	}
+
+	resets, err := j.purgeAll(ctx, j.resets, now)
+	if err != nil {
+		j.logger.Error("janitor: purging password resets", "error", err)
+	}
+
+	if snippets+sessions+logins+resets == 0 {
+		return
+	}
+	j.logger.Info("janitor: purged expired data", "snippets", snippets, "sessions", sessions, "login_attempts", logins,
+		"password_resets", resets)
+}
+
+// Deletes batches of rows that expired before the given time until a batch comes back short or
+// ctx is cancelled, returning how many rows were deleted altogether
+func (j *janitor) purgeAll(ctx context.Context, p purger, before time.Time) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		n, err := p.DeleteExpired(before, j.batchSize)
+		total += n
+		if err != nil || n < j.batchSize {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+// Pretends to have pending expired rows, deleting up to limit of them per call
+type fakePurger struct {
+	pending int
+	err     error
+	calls   int
+	before  time.Time
+}
+
+func (p *fakePurger) DeleteExpired(before time.Time, limit int) (int, error) {
+	p.calls++
+	p.before = before
+
+	n := p.pending
+	if n > limit {
+		n = limit
+	}
+	p.pending -= n
+	return n, p.err
+}
+
+func newTestJanitor(snippets, sessions, logins, resets *fakePurger, now time.Time) *janitor {
+	return &janitor{
+		snippets:  snippets,
+		sessions:  sessions,
+		logins:    logins,
+		resets:    resets,
+		interval:  time.Millisecond,
+		retention: 24 * time.Hour,
+		batchSize: 10,
+		now:       func() time.Time { return now },
+		newTicker: realTicker,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestJanitorPurge(t *testing.T) {
+	now := time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		pending          int
+		err              error
+		wantCalls        int
+		wantLeftSnippets int
+	}{
+		{
+			name:      "Nothing to do",
+			pending:   0,
+			wantCalls: 1,
+		},
+		{
+			name:      "One short batch",
+			pending:   7,
+			wantCalls: 1,
+		},
+		{
+			name:      "Several batches",
+			pending:   25,
+			wantCalls: 3,
+		},
+		{
+			name:      "Exact batches",
+			pending:   20,
+			wantCalls: 3,
+		},
+		{
+			name:             "Error stops the batches",
+			pending:          25,
+			err:              errors.New("deadlock"),
+			wantCalls:        1,
+			wantLeftSnippets: 15,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippets := &fakePurger{pending: tt.pending, err: tt.err}
+			sessions := &fakePurger{pending: tt.pending}
+			logins := &fakePurger{pending: tt.pending}
+			resets := &fakePurger{pending: tt.pending}
+
+			newTestJanitor(snippets, sessions, logins, resets, now).purge(context.Background())
+
+			assert.Equal(t, snippets.calls, tt.wantCalls)
+			assert.Equal(t, snippets.pending, tt.wantLeftSnippets)
+			assert.Equal(t, sessions.pending, 0)
+			assert.Equal(t, logins.pending, 0)
+			assert.Equal(t, resets.pending, 0)
+
+			// Snippets are kept for the retention window, sessions go as soon as they expire
+			assert.Equal(t, snippets.before, now.Add(-24*time.Hour))
+			assert.Equal(t, sessions.before, now)
+			assert.Equal(t, logins.before, now.Add(-loginAttemptRetention))
+			assert.Equal(t, resets.before, now)
+		})
+	}
+}
+
+func TestJanitorPurgeLogs(t *testing.T) {
+	now := time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		pending int
+		wantLog bool
+	}{
+		{name: "Nothing purged", pending: 0, wantLog: false},
+		{name: "Something purged", pending: 3, wantLog: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			j := newTestJanitor(&fakePurger{}, &fakePurger{pending: tt.pending}, &fakePurger{}, &fakePurger{}, now)
+			j.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+			j.purge(context.Background())
+
+			assert.Equal(t, strings.Contains(buf.String(), "purged expired data"), tt.wantLog)
+		})
+	}
+}
+
+// Tells the test each time it's asked to delete rows, so it knows when a purge has begun
+type signalPurger chan time.Time
+
+func (p signalPurger) DeleteExpired(before time.Time, limit int) (int, error) {
+	p <- before
+	return 0, nil
+}
+
+func TestJanitorRunTicks(t *testing.T) {
+	now := time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)
+	j := newTestJanitor(&fakePurger{}, &fakePurger{}, &fakePurger{}, &fakePurger{}, now)
+
+	snippets := make(signalPurger)
+	j.snippets = snippets
+
+	ticks := make(chan time.Time)
+	stopped := false
+	j.newTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		assert.Equal(t, d, j.interval)
+		return ticks, func() { stopped = true }
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.run(ctx)
+	}()
+
+	// Nothing is purged until the first tick
+	select {
+	case <-snippets:
+		t.Fatal("janitor purged before its first tick")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// and then once a tick
+	for i := 0; i < 3; i++ {
+		ticks <- now
+		select {
+		case before := <-snippets:
+			assert.Equal(t, before, now.Add(-j.retention))
+		case <-time.After(time.Second):
+			t.Fatalf("janitor didn't purge on tick %d", i+1)
+		}
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("janitor didn't stop after its context was cancelled")
+	}
+	assert.Equal(t, stopped, true)
+}
+
+func TestJanitorRunStops(t *testing.T) {
+	snippets := &fakePurger{}
+	sessions := &fakePurger{}
+	logins := &fakePurger{}
+	resets := &fakePurger{}
+	j := newTestJanitor(snippets, sessions, logins, resets, time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.run(ctx)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("janitor didn't stop after its context was cancelled")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// Log formats that -log-format accepts
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Creates the application's logger, writing one line per record to w as either logfmt-style
+// key=value pairs or JSON objects
+func newLogger(w io.Writer, format string) (*slog.Logger, error) {
+	switch format {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, nil)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// requestFields holds what log lines about a request carry besides its ID, which is only known
+// once the request has been handled. logRequest shares it through the request context as a
+// pointer, so middleware further down the chain can fill it in for the lines logged on the way
+// back up.
+type requestFields struct {
+	route  string // the pattern the request matched, "" until the router has matched one
+	userID int    // 0 until the request is authenticated
+}
+
+// Returns the fields logRequest shared for r, or empty ones for requests it didn't see
+func requestFieldsFrom(r *http.Request) *requestFields {
+	fields, ok := r.Context().Value(requestFieldsContextKey).(*requestFields)
+	if !ok {
+		return &requestFields{}
+	}
+	return fields
+}
+
+// Records who r was authenticated as in its log fields
+func setRequestUserID(r *http.Request, id int) {
+	requestFieldsFrom(r).userID = id
+}
+
+// Returns the ID the requestID middleware gave r, or "" if it didn't see r
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// Reports whether id is safe to take from a proxy's X-Request-ID header and write to the logs: up
+// to 128 letters, digits, dashes, underscores and dots, which covers UUIDs and the IDs proxies
+// generate
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Generates a random 128-bit request ID, hex encoded
+func newRequestID() string {
+	b := make([]byte, 16)
+	// Read only fails if the OS's random source does, in which case sessions and tokens can't be
+	// made either, so there's nothing better to do than log a zero ID
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusWriter records the status code and the number of body bytes written through it, which the
+// request log can't otherwise see
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	// Only the first call counts, like http.ResponseWriter's
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	// Writing without calling WriteHeader first sends a 200
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+// Lets http.ResponseController reach the underlying writer, e.g. to flush it
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+
+	"github.com/mhrdini/snippetbox/internal/mailer"
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+// Body of the password reset email, given the user's name and the link. The hour is
+// models.PasswordResetTTL.
+const passwordResetBody = `Hi %s,
+
+Someone, hopefully you, asked to reset the password of your Snippetbox account. To choose a new
+one, follow this link within the next hour:
+
+%s
+
+If it wasn't you, you can ignore this email and your password will stay as it is.
+`
+
+// Emails the user with the given email a link to reset their password, if there is such a user.
+// Runs in the background after the request has been responded to, so problems are logged to
+// logger, which identifies the request, rather than returned.
+func (app *application) sendPasswordReset(logger *slog.Logger, email string) {
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			logErrorTo(logger, err)
+		}
+		return
+	}
+
+	token, err := app.passwordResets.Insert(user.ID)
+	if err != nil {
+		logErrorTo(logger, err)
+		return
+	}
+
+	// The link is built from the configured base URL rather than the request's Host header, which
+	// the client chooses, so no one can get a link to their own server sent out
+	link := app.baseURL + "/user/password/reset?token=" + url.QueryEscape(token)
+
+	err = app.mailer.Send(mailer.Message{
+		To:      (&mail.Address{Name: user.Name, Address: user.Email}).String(),
+		Subject: "Reset your Snippetbox password",
+		Body:    fmt.Sprintf(passwordResetBody, user.Name, link),
+	})
+	if err != nil {
+		logErrorTo(logger, err)
+	}
+}
@@ -1,88 +1,174 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql" // we need the driver's init() function to run so it can register itself with the sql package
+	"github.com/mhrdini/snippetbox/internal/mailer"
 	"github.com/mhrdini/snippetbox/internal/models"
 )
 
-type Config struct {
-	Addr      string
-	StaticDir string
-	DSN       string
-}
-
 // Define an application struct to hold the application-wide dependencies for the web application.
 type application struct {
-	errorLog       *log.Logger
-	infoLog        *log.Logger
+	logger         *slog.Logger
+	metrics        *appMetrics
 	snippets       models.SnippetModelInterface
+	revisions      models.RevisionModelInterface
+	tokens         models.TokenModelInterface
+	tags           models.TagModelInterface
 	users          models.UserModelInterface
+	passwordResets models.PasswordResetModelInterface
+	mailer         mailer.Mailer
+	baseURL        string // what links in emails start with, without a trailing slash
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	trustedProxies prefixList // reverse proxies whose forwarding headers are believed
+	healthChecks   []healthCheck
+	rateLimiters   rateLimiters
+	shuttingDown   atomic.Bool    // set once a shutdown signal arrives, failing /readyz
+	wg             sync.WaitGroup // tracks goroutines started by background, shutdown waits for them
 }
 
 func main() {
-	cfg := new(Config)
+	// The log format is part of the config, so problems with the config itself are written as
+	// plain text
+	cfg, err := loadConfig(os.Args[0], os.Args[1:], os.Getenv, os.Stderr)
+	if err != nil {
+		// -h and -help have already printed the usage
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	// Define a new command-line flag with its identifier, a default value, and some short
-	// help text explaining what the flag controls
-	flag.StringVar(&cfg.Addr, "addr", ":8000", "HTTP network address")
-	flag.StringVar(&cfg.StaticDir, "static-dir", "../../ui/static/", "Path to static assets")
-	flag.StringVar(&cfg.DSN, "dsn", "web:web@/snippetbox?parseTime=true", "MySQL database connection string")
+	if cfg.PrintConfig {
+		err = cfg.print(os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Parse flags before you use them
-	flag.Parse()
+	// Create a structured logger writing one record per line to os.Stdout, as text or JSON. The
+	// format has already been validated.
+	logger, err := newLogger(os.Stdout, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	// Create loggers for writing info and error messages.
-	// InfoLog -> Writes to os.Stdout, uses INFO prefix, and flags to include additional info such as
-	// local datetime
-	// ErrorLog -> Writes to os.Stderr, use log.Lshortfile flag to include relevant file name and line number
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// Errors are returned rather than fatal, so run's deferred clean up happens before exiting
+	err = run(cfg, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
 
+// run sets up the application and serves it until it's told to shut down, returning nil if it
+// shut down cleanly
+func run(cfg *Config, logger *slog.Logger) error {
 	// Open DB here
 	db, err := openDB(cfg.DSN)
 	if err != nil {
-		errorLog.Fatal(err)
+		return err
 	}
-	defer db.Close()
+	defer func() {
+		db.Close()
+		logger.Info("closed database connections")
+	}()
 
 	// Initialise template cache
 	templateCache, err := newTemplateCache()
 	if err != nil {
-		errorLog.Fatal(err)
+		return err
 	}
 
 	// Initialise form decoder
 	formDecoder := form.NewDecoder()
 
-	// Initialise session manager, configured to use MySQL DB as session store
+	metrics := newAppMetrics()
+	metrics.registerDBStats(db)
+
+	// Initialise session manager, configured to use MySQL DB as session store. The janitor deletes
+	// expired sessions, so the store's own cleanup goroutine is turned off.
+	sessionStore := mysqlstore.NewWithCleanupInterval(db, 0)
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Store = &metricsStore{
+		Store: sessionStore,
+		ops:   metrics.sessionOps,
+	}
+	sessionManager.Lifetime = cfg.SessionLifetime
 
 	// Initialise a new instance of application containing the dependencies.
 	app := &application{
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
+		logger:         logger,
+		metrics:        metrics,
+		snippets:       &models.SnippetModel{DB: db, BcryptCost: cfg.BcryptCost},
+		revisions:      &models.RevisionModel{DB: db},
+		tokens:         &models.TokenModel{DB: db},
+		tags:           &models.TagModel{DB: db},
+		users:          &models.UserModel{DB: db, BcryptCost: cfg.BcryptCost},
+		passwordResets: &models.PasswordResetModel{DB: db},
+		baseURL:        strings.TrimSuffix(cfg.BaseURL, "/"),
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		trustedProxies: cfg.TrustedProxies,
+	}
+
+	// Without an SMTP server, email goes to files in the outbox for developers to read. Anywhere
+	// else that's almost certainly a mistake, leaving live reset links on disk and never sending them.
+	if cfg.SMTPHost != "" {
+		app.mailer = &mailer.SMTP{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Sender:   cfg.MailSender,
+		}
+	} else {
+		app.mailer = &mailer.Outbox{Dir: cfg.OutboxDir, Sender: cfg.MailSender}
+		if cfg.isDevelopment() {
+			logger.Info("no SMTP server, writing email to the outbox", "dir", cfg.OutboxDir)
+		} else {
+			logger.Warn("no SMTP server outside development, email is written to the outbox instead of being sent, set -smtp-host",
+				"dir", cfg.OutboxDir, "base_url", cfg.BaseURL)
+		}
+	}
+
+	app.rateLimiters.passphrase = newRateLimiter(passphraseRateLimit)
+	if cfg.RateLimit {
+		app.rateLimiters.strict = newRateLimiter(strictRateLimit)
+		app.rateLimiters.loose = newRateLimiter(looseRateLimit)
+	}
+
+	// What /readyz checks before saying the server can take traffic
+	app.healthChecks = []healthCheck{
+		{name: "database", check: db.PingContext},
+		{name: "templates", check: app.checkTemplates},
+		{name: "sessions", check: sessionStoreCheck(sessionStore)},
 	}
 
 	// Initialise TLS config for non-default TLS/HTTPS settings
@@ -96,21 +182,115 @@ func main() {
 	}
 
 	// Initialise a new http.Server struct, setting the Addr and Handler fields to have it use the
-	// appropriate network address and routes, and the ErrorLog field so that the server now uses
-	// the custom errorLog logger in the event of any problems
+	// appropriate network address and routes, and the ErrorLog field so that the server's own
+	// problems are logged as structured error records too
 	srv := &http.Server{
 		Addr:         cfg.Addr,
-		ErrorLog:     errorLog,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		Handler:      app.routes(), // servemux in routes.go
 		TLSConfig:    tlsConfig,
-		IdleTimeout:  time.Minute,     // reduce keep-alive to close connections earlier
-		ReadTimeout:  5 * time.Second, // close connection if accepted connection still hasn't read req headers/body
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.IdleTimeout, // reduce keep-alive to close connections earlier
+		ReadTimeout:  cfg.ReadTimeout, // close connection if accepted connection still hasn't read req headers/body
+		WriteTimeout: cfg.WriteTimeout,
+	}
+
+	// Purge expired data in the background until the server stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if cfg.JanitorInterval > 0 {
+		j := &janitor{
+			snippets:  &models.SnippetModel{DB: db},
+			sessions:  &models.SessionModel{DB: db},
+			logins:    &models.LoginAttemptModel{DB: db},
+			resets:    &models.PasswordResetModel{DB: db},
+			interval:  cfg.JanitorInterval,
+			retention: cfg.Retention,
+			batchSize: janitorBatchSize,
+			now:       time.Now,
+			newTicker: realTicker,
+			logger:    logger,
+		}
+		app.background(func() {
+			j.run(ctx)
+		})
+	}
+
+	// Metrics go on a listener of their own, so they can be kept off the public network
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		metricsSrv = &http.Server{
+			Addr:         cfg.MetricsAddr,
+			ErrorLog:     srv.ErrorLog,
+			Handler:      metricsRoutes(metrics),
+			IdleTimeout:  cfg.IdleTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		}
+		app.background(func() {
+			logger.Info("starting metrics server", "addr", metricsSrv.Addr)
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("metrics server stopped", "error", err)
+			}
+		})
+	}
+
+	err = app.serve(srv, cfg)
+
+	// Scrapes are cheap to retry, so there's no need to wait for them to finish
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+
+	// Whether or not the server stopped cleanly, stop the background tasks and let them finish
+	logger.Info("waiting for background tasks to finish")
+	cancel()
+	app.wg.Wait()
+
+	return err
+}
+
+// serve runs srv until it fails or a SIGINT or SIGTERM arrives. On a signal it fails /readyz and
+// waits cfg.DrainDelay for load balancers to notice and stop sending requests, then stops
+// accepting connections and gives in-flight requests up to cfg.ShutdownTimeout to finish,
+// returning nil if they did.
+func (app *application) serve(srv *http.Server, cfg *Config) error {
+	shutdownErr := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-quit
+
+		app.logger.Info("shutting down server", "signal", sig.String())
+
+		app.shuttingDown.Store(true)
+		if cfg.DrainDelay > 0 {
+			app.logger.Info("draining connections", "delay", cfg.DrainDelay)
+			time.Sleep(cfg.DrainDelay)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	app.logger.Info("starting server", "addr", srv.Addr)
+	err := srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	// Shutdown makes ListenAndServeTLS return ErrServerClosed straight away, anything else means
+	// the server failed by itself
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		return fmt.Errorf("shutting down server: %w", err)
 	}
 
-	infoLog.Printf("Starting server on %s\n", cfg.Addr)
-	err = srv.ListenAndServeTLS("../../tls/cert.pem", "../../tls/key.pem")
-	errorLog.Fatal(err)
+	app.logger.Info("stopped server")
+	return nil
 }
 
 // openDB() wraps sql.Open() and returns a sql.DB connection pool for a given DSN
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/julienschmidt/httprouter"
+	"github.com/mhrdini/snippetbox/internal/metrics"
+)
+
+// appMetrics are the metrics the application records as it serves requests, exposed at /metrics
+// on the metrics listener
+type appMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+	inFlight        *metrics.Gauge
+	renderDuration  *metrics.Histogram
+	sessionOps      *metrics.Counter
+	panics          *metrics.Counter
+	rateLimited     *metrics.Counter
+}
+
+func newAppMetrics() *appMetrics {
+	reg := metrics.NewRegistry()
+
+	return &appMetrics{
+		registry: reg,
+		requests: reg.NewCounter("snippetbox_http_requests_total",
+			"HTTP requests served, by route pattern and status.", "method", "route", "status"),
+		requestDuration: reg.NewHistogram("snippetbox_http_request_duration_seconds",
+			"How long HTTP requests took to serve, by route pattern and status.", metrics.DefaultBuckets, "method", "route", "status"),
+		inFlight: reg.NewGauge("snippetbox_http_requests_in_flight",
+			"HTTP requests being served."),
+		renderDuration: reg.NewHistogram("snippetbox_template_render_duration_seconds",
+			"How long pages took to render, by template.", metrics.DefaultBuckets, "template"),
+		sessionOps: reg.NewCounter("snippetbox_session_store_operations_total",
+			"Session store operations, by operation and whether they succeeded.", "operation", "result"),
+		panics: reg.NewCounter("snippetbox_panics_recovered_total",
+			"Panics in handlers that recoverPanic turned into 500 responses."),
+		rateLimited: reg.NewCounter("snippetbox_rate_limited_requests_total",
+			"Requests turned away with a 429 for going over their rate limit, by policy.", "policy"),
+	}
+}
+
+// Records a request once it's been served. route is the pattern it matched, or "" if it didn't
+// match one.
+func (m *appMetrics) observeRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	method = methodLabel(method)
+	code := strconv.Itoa(status)
+	m.requests.Inc(method, route, code)
+	m.requestDuration.Observe(duration.Seconds(), method, route, code)
+}
+
+// Returns the method label for a request, "other" for anything but the standard methods. Clients
+// can send any token as the method, and each would otherwise make new series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// Exposes the connection pool's statistics, read from db.Stats() at each scrape
+func (m *appMetrics) registerDBStats(db *sql.DB) {
+	stat := func(fn func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+
+	m.registry.NewGaugeFunc("snippetbox_db_max_open_connections", "Maximum number of open connections to the database.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	m.registry.NewGaugeFunc("snippetbox_db_open_connections", "Established connections to the database, in use or idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	m.registry.NewGaugeFunc("snippetbox_db_in_use_connections", "Database connections in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	m.registry.NewGaugeFunc("snippetbox_db_idle_connections", "Idle database connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	m.registry.NewCounterFunc("snippetbox_db_wait_count_total", "Times a query waited for a free database connection.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	m.registry.NewCounterFunc("snippetbox_db_wait_duration_seconds_total", "Time spent waiting for free database connections.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	m.registry.NewCounterFunc("snippetbox_db_max_idle_closed_total", "Connections closed because of the idle connection limit.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	m.registry.NewCounterFunc("snippetbox_db_max_idle_time_closed_total", "Connections closed for being idle too long.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	m.registry.NewCounterFunc("snippetbox_db_max_lifetime_closed_total", "Connections closed for reaching their maximum lifetime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
+
+// metricsStore wraps a session store to count its operations and their failures
+type metricsStore struct {
+	scs.Store
+	ops *metrics.Counter
+}
+
+func (s *metricsStore) observe(operation string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	s.ops.Inc(operation, result)
+}
+
+func (s *metricsStore) Find(token string) ([]byte, bool, error) {
+	b, found, err := s.Store.Find(token)
+	s.observe("find", err)
+	return b, found, err
+}
+
+func (s *metricsStore) Commit(token string, b []byte, expiry time.Time) error {
+	err := s.Store.Commit(token, b, expiry)
+	s.observe("commit", err)
+	return err
+}
+
+func (s *metricsStore) Delete(token string) error {
+	err := s.Store.Delete(token)
+	s.observe("delete", err)
+	return err
+}
+
+// patternRouter is an httprouter.Router that notes the pattern each request matched in its
+// request fields, since httprouter doesn't say, so requests can be counted per route rather than
+// per URL
+type patternRouter struct {
+	*httprouter.Router
+}
+
+func (pr patternRouter) Handler(method, path string, handler http.Handler) {
+	pr.Router.Handler(method, path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestFieldsFrom(r).route = path
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+func (pr patternRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	pr.Handler(method, path, handler)
+}
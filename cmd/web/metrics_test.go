@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.get(t, "/s/P0nd5ilent")
+	ts.get(t, "/s/W1ntryF0rs")
+	ts.get(t, "/s/N0tAThing")
+	ts.get(t, "/no/such/route")
+	ts.do(t, "BREW", "/no/such/route", nil, "")
+
+	// Scraped from the metrics listener's routes, not the application's
+	rr := httptest.NewRecorder()
+	metricsRoutes(app.metrics).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8")
+
+	body := rr.Body.String()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "Requests by route pattern",
+			want: `snippetbox_http_requests_total{method="GET",route="/s/:slug",status="200"} 2`,
+		},
+		{
+			name: "Requests by status",
+			want: `snippetbox_http_requests_total{method="GET",route="/s/:slug",status="404"} 1`,
+		},
+		{
+			name: "Unmatched requests",
+			want: `snippetbox_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		},
+		{
+			name: "Non-standard methods",
+			want: `snippetbox_http_requests_total{method="other",route="unmatched",status="404"} 1`,
+		},
+		{
+			name: "Latency histogram",
+			want: `snippetbox_http_request_duration_seconds_count{method="GET",route="/s/:slug",status="200"} 2`,
+		},
+		{
+			name: "Nothing in flight",
+			want: "snippetbox_http_requests_in_flight 0",
+		},
+		{
+			name: "Template renders",
+			want: `snippetbox_template_render_duration_seconds_count{template="view.tmpl.html"} 2`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.StringContains(t, body, tt.want)
+		})
+	}
+
+	t.Run("Not served by the application", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/metrics")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+// Fails every operation
+type failingStore struct{}
+
+func (failingStore) Find(token string) ([]byte, bool, error) {
+	return nil, false, errors.New("store is down")
+}
+
+func (failingStore) Commit(token string, b []byte, expiry time.Time) error {
+	return errors.New("store is down")
+}
+
+func (failingStore) Delete(token string) error {
+	return errors.New("store is down")
+}
+
+func TestMetricsStore(t *testing.T) {
+	m := newAppMetrics()
+
+	ok := &metricsStore{Store: memstore.New(), ops: m.sessionOps}
+	ok.Commit("token", []byte("data"), time.Now().Add(time.Hour))
+	ok.Find("token")
+	ok.Find("other")
+	ok.Delete("token")
+
+	failing := &metricsStore{Store: failingStore{}, ops: m.sessionOps}
+	failing.Find("token")
+
+	var b strings.Builder
+	err := m.registry.WriteText(&b)
+	assert.NilError(t, err)
+
+	for _, want := range []string{
+		`snippetbox_session_store_operations_total{operation="commit",result="ok"} 1`,
+		`snippetbox_session_store_operations_total{operation="delete",result="ok"} 1`,
+		`snippetbox_session_store_operations_total{operation="find",result="error"} 1`,
+		`snippetbox_session_store_operations_total{operation="find",result="ok"} 2`,
+	} {
+		assert.StringContains(t, b.String(), want)
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/justinas/nosurf"
+	"github.com/mhrdini/snippetbox/internal/models"
 )
 
 // Middleware can be executed:
@@ -35,10 +38,61 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// Gives every request an ID to tie its log lines together. The ID is taken from the X-Request-ID
+// header when a trusted proxy sent one, so it matches the proxy's logs, and is generated otherwise.
+// It's echoed in the response's X-Request-ID header and on the 500 page, so users can quote it.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !app.fromTrustedProxy(r) || !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Logs every request once it's been handled, with the status and size of the response and how long
+// it took, and records it in the request metrics. The route and, once authenticate has run, the
+// user are shared through the request context so errors logged while handling it can be tied back
+// to them.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		app.metrics.inFlight.Inc()
+
+		fields := &requestFields{}
+		r = r.WithContext(context.WithValue(r.Context(), requestFieldsContextKey, fields))
+
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			// Handlers that don't write anything send an empty 200
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			duration := time.Since(start)
+
+			app.metrics.inFlight.Dec()
+			app.metrics.observeRequest(r.Method, fields.route, sw.status, duration)
+
+			app.logger.Info("request",
+				"request_id", requestID(r),
+				"remote_addr", r.RemoteAddr,
+				"proto", r.Proto,
+				"method", r.Method,
+				"uri", r.URL.RequestURI(),
+				"route", fields.route,
+				"status", sw.status,
+				"bytes", sw.bytes,
+				"duration", duration,
+				"user_id", fields.userID,
+			)
+		}()
+
+		next.ServeHTTP(sw, r)
 	})
 }
 
@@ -50,10 +104,11 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				app.metrics.panics.Inc()
 				// Setting this acts as a trigger to make Go's HTTP/1 server auto-close the connection
 				w.Header().Set("Connection", "close")
 				// Normalise any-typed error from recover() into an Errorf object format
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 
@@ -78,6 +133,10 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 // Create noSurf middleware which uses a customised CSRF cookie
 // with the Secure, Path, and HttpOnly attrs set
 func noSurf(next http.Handler) http.Handler {
+	return newCSRFHandler(next)
+}
+
+func newCSRFHandler(next http.Handler) *nosurf.CSRFHandler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
@@ -91,6 +150,12 @@ func noSurf(next http.Handler) http.Handler {
 // Share authenticatedUserID into context to avoid DB checks at every request
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Already authenticated by a personal access token, which takes precedence over the session
+		if app.isAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Check for authenticatedUserID in context, will return zero value for int (0) if not found
 		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 		if id == 0 {
@@ -98,17 +163,64 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		exists, err := app.users.Exists(id)
+		// A session stops being logged in once the user's password changes, or the user's deleted,
+		// so anyone who got in with the old password is cut off
+		version, err := app.users.SessionVersion(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		if err != nil || version != app.sessionManager.GetInt(r.Context(), "sessionVersion") {
+			app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
+		r = r.WithContext(ctx)
+		setRequestUserID(r, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Only lets the request through if the snippet in the :slug route parameter belongs to the
+// authenticated user. Must come after requireAuthentication in the chain. The snippet is shared
+// via the request context so the handler doesn't need to fetch it again.
+func (app *application) requireSnippetOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slug, err := readSlugParam(r)
 		if err != nil {
-			app.serverError(w, err)
+			app.notFound(w)
 			return
 		}
 
-		if exists {
-			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-			r = r.WithContext(ctx)
+		s, err := app.snippets.GetBySlug(slug)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
 		}
 
-		next.ServeHTTP(w, r)
+		userID := app.authenticatedUserID(r)
+		if !s.VisibleTo(userID) {
+			app.notFound(w)
+			return
+		}
+		if s.UserID != userID {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+		if s.Burned {
+			app.gone(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), snippetContextKey, s)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -2,9 +2,13 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/mhrdini/snippetbox/internal/assert"
@@ -81,3 +85,200 @@ func TestSecureHeaders(t *testing.T) {
 
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestLogRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBytes  int
+		wantUserID int
+	}{
+		{
+			name: "Written response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("I'm a teapot"))
+			},
+			wantStatus: http.StatusTeapot,
+			wantBytes:  12,
+		},
+		{
+			name:       "Empty response",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Authenticated",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				setRequestUserID(r, 7)
+				w.Write([]byte("OK"))
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  2,
+			wantUserID: 7,
+		},
+		{
+			name: "Server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("oops")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantBytes:  len("Internal Server Error\n\nPlease quote request ID  when reporting this problem.\n") + 32,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newTestApplication(t)
+			app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/snippets?sort=newest", nil)
+			app.requestID(app.logRequest(app.recoverPanic(tt.handler))).ServeHTTP(rr, r)
+
+			// The request's line is always the last one, after any errors logged while handling it
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+			var entry struct {
+				Msg       string `json:"msg"`
+				RequestID string `json:"request_id"`
+				Method    string `json:"method"`
+				URI       string `json:"uri"`
+				Status    int    `json:"status"`
+				Bytes     int    `json:"bytes"`
+				UserID    int    `json:"user_id"`
+			}
+			err := json.Unmarshal([]byte(lines[len(lines)-1]), &entry)
+			assert.NilError(t, err)
+
+			assert.Equal(t, entry.Msg, "request")
+			assert.Equal(t, entry.RequestID, rr.Header().Get("X-Request-ID"))
+			assert.Equal(t, entry.Method, http.MethodGet)
+			assert.Equal(t, entry.URI, "/snippets?sort=newest")
+			assert.Equal(t, entry.Status, tt.wantStatus)
+			assert.Equal(t, entry.Bytes, tt.wantBytes)
+			assert.Equal(t, entry.UserID, tt.wantUserID)
+
+			if tt.wantStatus == http.StatusInternalServerError {
+				// The user is given the ID to quote, which finds the error with its stack trace
+				assert.StringContains(t, rr.Body.String(), "Please quote request ID "+entry.RequestID)
+				assert.Equal(t, len(lines), 2)
+				assert.StringContains(t, lines[0], `"msg":"oops"`)
+				assert.StringContains(t, lines[0], `"request_id":"`+entry.RequestID+`"`)
+				assert.StringContains(t, lines[0], `"trace":"goroutine`)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		wantID     string // "" for a generated ID
+	}{
+		{
+			name:       "No header",
+			remoteAddr: "10.0.0.1:1234",
+		},
+		{
+			name:       "Trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "3f1c0e5e-8a2b-4c55-9d6e-1b2a3c4d5e6f",
+			wantID:     "3f1c0e5e-8a2b-4c55-9d6e-1b2a3c4d5e6f",
+		},
+		{
+			name:       "Untrusted client",
+			remoteAddr: "192.0.2.1:1234",
+			header:     "3f1c0e5e-8a2b-4c55-9d6e-1b2a3c4d5e6f",
+		},
+		{
+			name:       "Trusted proxy with a malformed ID",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "fake\nlevel=ERROR",
+		},
+		{
+			name:       "Trusted proxy with an overlong ID",
+			remoteAddr: "10.0.0.1:1234",
+			header:     strings.Repeat("a", 129),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			err := app.trustedProxies.Set("10.0.0.0/8")
+			assert.NilError(t, err)
+
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = requestID(r)
+			})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			app.requestID(next).ServeHTTP(rr, r)
+
+			if tt.wantID == "" {
+				assert.Equal(t, len(got), 32)
+			} else {
+				assert.Equal(t, got, tt.wantID)
+			}
+			assert.Equal(t, rr.Header().Get("X-Request-ID"), got)
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name              string
+		userID            int
+		sessionVersion    int
+		wantAuthenticated bool
+	}{
+		{
+			name:              "Current session",
+			userID:            1,
+			wantAuthenticated: true,
+		},
+		{
+			name:           "Logged in before the password changed",
+			userID:         1,
+			sessionVersion: 1,
+		},
+		{
+			name:   "Deleted user",
+			userID: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			ctx, err := app.sessionManager.Load(context.Background(), "")
+			assert.NilError(t, err)
+			app.sessionManager.Put(ctx, "authenticatedUserID", tt.userID)
+			app.sessionManager.Put(ctx, "sessionVersion", tt.sessionVersion)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+			var authenticated bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authenticated = app.isAuthenticated(r)
+			})
+			app.authenticate(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, authenticated, tt.wantAuthenticated)
+			// Sessions that no longer count are logged out for good
+			assert.Equal(t, app.sessionManager.Exists(ctx, "authenticatedUserID"), tt.wantAuthenticated)
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+// rateLimitPolicy is how many requests a client may make to a group of routes: burst straight
+// away, then rate per second on average
+type rateLimitPolicy struct {
+	name  string
+	rate  float64
+	burst int
+}
+
+var (
+	// For routes a script could abuse: logging in, signing up, unlocking snippets and creating them
+	strictRateLimit = rateLimitPolicy{name: "strict", rate: 10.0 / 60, burst: 5}
+	// For everything else someone browsing might ask for, only stopping floods
+	looseRateLimit = rateLimitPolicy{name: "loose", rate: 20, burst: 60}
+	// For passphrase guesses at one protected snippet from one IP address
+	passphraseRateLimit = rateLimitPolicy{name: "passphrase", rate: 1.0 / 60, burst: 5}
+)
+
+// rateLimiters holds a limiter for each policy. strict and loose are nil while rate limiting is
+// turned off, but passphrase is always set, since it's what stops passphrases being guessed.
+type rateLimiters struct {
+	strict     *rateLimiter
+	loose      *rateLimiter
+	passphrase *rateLimiter
+}
+
+// How often allow looks for buckets that can be forgotten
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a token bucket per client for one policy. Each request takes a token, and tokens
+// are refilled at the policy's rate up to its burst.
+type rateLimiter struct {
+	policy    rateLimitPolicy
+	now       func() time.Time // the clock, swapped out in tests
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
+}
+
+func newRateLimiter(policy rateLimitPolicy) *rateLimiter {
+	return &rateLimiter{
+		policy:  policy,
+		now:     time.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Takes a token from key's bucket, reporting whether there was one and, if there wasn't, how long
+// until there will be
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.policy.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.policy.burst), b.tokens+now.Sub(b.last).Seconds()*l.policy.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.policy.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// Forgets the buckets that have had time to fill back up, since they're no different from the new
+// ones a client's next request would get. Keeps memory bounded by the number of clients seen in
+// the last few minutes rather than ever.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		full := b.tokens + now.Sub(b.last).Seconds()*l.policy.rate
+		if full >= float64(l.policy.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware limiting each client's requests to each route it wraps with limiter's policy, so
+// using up the allowance for one route, e.g. logging in, doesn't hold a client back on another.
+// Authenticated clients are told apart by user, anyone else by IP address. Must come after
+// authenticate in the chain. A nil limiter lets everything through.
+func (app *application) rateLimit(limiter *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := "ip:" + app.clientIP(r)
+			if id := app.authenticatedUserID(r); id != 0 {
+				client = "user:" + strconv.Itoa(id)
+			}
+			// The router has recorded the pattern the request matched by now
+			key := r.Method + " " + requestFieldsFrom(r).route + " " + client
+
+			ok, wait := limiter.allow(key)
+			if !ok {
+				app.metrics.rateLimited.Inc(limiter.policy.name)
+
+				// Rounded up, so a client that waits as long as it's told will get through
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					app.apiError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after the number of seconds in the Retry-After header")
+					return
+				}
+				app.clientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Takes one of the client's guesses at the passphrase of snippet id, returning
+// models.ErrTooManyAttempts with a Retry-After header set if it's out of them. A nil passphrase
+// limiter allows every guess.
+func (app *application) allowPassphraseGuess(w http.ResponseWriter, r *http.Request, id int) error {
+	limiter := app.rateLimiters.passphrase
+	if limiter == nil {
+		return nil
+	}
+
+	ok, wait := limiter.allow("ip:" + app.clientIP(r) + ":snippet:" + strconv.Itoa(id))
+	if !ok {
+		app.metrics.rateLimited.Inc(limiter.policy.name)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return models.ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// Returns the IP address of the client that made r. Requests from a trusted proxy are attributed
+// to the address it appended to X-Forwarded-For, or, if that's a trusted proxy too, the address
+// before it, and so on. Addresses further left than the first untrusted one could have been made
+// up by the client, so they're never used.
+func (app *application) clientIP(r *http.Request) string {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	addr := addrPort.Addr().Unmap()
+
+	if !app.trustedProxies.contains(addr) {
+		return addr.String()
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// A proxy we trust wouldn't write garbage, so it came from further left
+			break
+		}
+		addr = hop.Unmap()
+		if !app.trustedProxies.contains(addr) {
+			break
+		}
+	}
+
+	return addr.String()
+}
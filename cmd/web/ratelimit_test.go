@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+// Returns a limiter for policy whose clock only moves when the returned function is called
+func newTestRateLimiter(policy rateLimitPolicy) (*rateLimiter, func(time.Duration)) {
+	now := time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)
+	l := newRateLimiter(policy)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRateLimiter(t *testing.T) {
+	l, advance := newTestRateLimiter(rateLimitPolicy{name: "test", rate: 1, burst: 2})
+
+	steps := []struct {
+		name     string
+		advance  time.Duration
+		key      string
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{name: "First of the burst", key: "a", wantOK: true},
+		{name: "Second of the burst", key: "a", wantOK: true},
+		{name: "Burst used up", key: "a", wantWait: time.Second},
+		{name: "Other clients unaffected", key: "b", wantOK: true},
+		{name: "Half refilled", advance: 500 * time.Millisecond, key: "a", wantWait: 500 * time.Millisecond},
+		{name: "Refilled", advance: 500 * time.Millisecond, key: "a", wantOK: true},
+		{name: "Only one refilled", key: "a", wantWait: time.Second},
+		{name: "Refills stop at the burst", advance: time.Hour, key: "a", wantOK: true},
+		{name: "Second after the pause", key: "a", wantOK: true},
+		{name: "Third after the pause", key: "a", wantWait: time.Second},
+	}
+
+	for _, step := range steps {
+		advance(step.advance)
+		ok, wait := l.allow(step.key)
+		assert.Equal(t, ok, step.wantOK)
+		assert.Equal(t, wait, step.wantWait)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l, advance := newTestRateLimiter(rateLimitPolicy{name: "test", rate: 0.1, burst: 10})
+
+	l.allow("idle")
+	for i := 0; i < 10; i++ {
+		l.allow("busy")
+	}
+
+	// "idle" has filled back up by the next sweep, but "busy" is still short of tokens
+	advance(rateLimitSweepInterval - 5*time.Second)
+	l.allow("busy")
+	advance(5 * time.Second)
+	l.allow("new")
+
+	_, ok := l.buckets["idle"]
+	assert.Equal(t, ok, false)
+	_, ok = l.buckets["busy"]
+	assert.Equal(t, ok, true)
+	assert.Equal(t, len(l.buckets), 2)
+}
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	limiter, _ := newTestRateLimiter(rateLimitPolicy{name: "test", rate: 0.1, burst: 1})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := app.rateLimit(limiter)(next)
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		userID     int
+		wantCode   int
+		wantBody   string
+		wantRetry  string
+	}{
+		{
+			name:       "Allowed",
+			path:       "/user/login",
+			remoteAddr: "192.0.2.1:1234",
+			wantCode:   http.StatusOK,
+			wantBody:   "OK",
+		},
+		{
+			name:       "Limited",
+			path:       "/user/login",
+			remoteAddr: "192.0.2.1:1234",
+			wantCode:   http.StatusTooManyRequests,
+			wantBody:   "Too Many Requests",
+			wantRetry:  "10",
+		},
+		{
+			name:       "Limited API",
+			path:       "/api/v1/snippets",
+			remoteAddr: "192.0.2.1:5678",
+			wantCode:   http.StatusTooManyRequests,
+			wantBody:   `"message": "rate limit exceeded`,
+			wantRetry:  "10",
+		},
+		{
+			name:       "Other IP",
+			path:       "/user/login",
+			remoteAddr: "192.0.2.2:1234",
+			wantCode:   http.StatusOK,
+			wantBody:   "OK",
+		},
+		{
+			name:       "Authenticated user from a limited IP",
+			path:       "/user/login",
+			remoteAddr: "192.0.2.1:1234",
+			userID:     1,
+			wantCode:   http.StatusOK,
+			wantBody:   "OK",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.userID != 0 {
+				ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+				ctx = context.WithValue(ctx, authenticatedUserIDContextKey, tt.userID)
+				r = r.WithContext(ctx)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+			assert.StringContains(t, rr.Body.String(), tt.wantBody)
+			assert.Equal(t, rr.Header().Get("Retry-After"), tt.wantRetry)
+		})
+	}
+}
+
+func TestRateLimitPerRoute(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimiters.strict, _ = newTestRateLimiter(rateLimitPolicy{name: "strict", rate: 0.1, burst: 1})
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Logging in takes the login allowance the client had as an IP address, and the next try at it
+	// as the user uses up theirs
+	csrfToken := ts.login(t)
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	status, _, _ := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, status, http.StatusUnprocessableEntity)
+	status, _, _ = ts.postForm(t, "/user/login", form)
+	assert.Equal(t, status, http.StatusTooManyRequests)
+
+	// but the user can still create snippets
+	form.Add("title", "An old silent pond")
+	form.Add("content", "An old silent pond...")
+	form.Add("visibility", "public")
+	form.Add("expires", "1w")
+	status, _, _ = ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, status, http.StatusSeeOther)
+}
+
+func TestAllowPassphraseGuess(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimiters.passphrase, _ = newTestRateLimiter(rateLimitPolicy{name: "passphrase", rate: 1.0 / 60, burst: 1})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		snippetID  int
+		wantErr    error
+		wantRetry  string
+	}{
+		{name: "First guess", remoteAddr: "192.0.2.1:1234", snippetID: 7},
+		{name: "Out of guesses", remoteAddr: "192.0.2.1:5678", snippetID: 7, wantErr: models.ErrTooManyAttempts, wantRetry: "60"},
+		{name: "Other snippet", remoteAddr: "192.0.2.1:1234", snippetID: 8},
+		{name: "Other IP", remoteAddr: "192.0.2.2:1234", snippetID: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+
+			err := app.allowPassphraseGuess(rr, r, tt.snippetID)
+			assert.Equal(t, err, tt.wantErr)
+			assert.Equal(t, rr.Header().Get("Retry-After"), tt.wantRetry)
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	app := newTestApplication(t)
+	err := app.trustedProxies.Set("10.0.0.0/8,::1")
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "Direct",
+			remoteAddr: "192.0.2.1:1234",
+			want:       "192.0.2.1",
+		},
+		{
+			name:         "Untrusted client claiming another address",
+			remoteAddr:   "192.0.2.1:1234",
+			forwardedFor: []string{"198.51.100.7"},
+			want:         "192.0.2.1",
+		},
+		{
+			name:         "Trusted proxy",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"198.51.100.7"},
+			want:         "198.51.100.7",
+		},
+		{
+			name:         "Client spoofing through a trusted proxy",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.9, 198.51.100.7"},
+			want:         "198.51.100.7",
+		},
+		{
+			name:         "Chain of trusted proxies",
+			remoteAddr:   "[::1]:1234",
+			forwardedFor: []string{"198.51.100.7, 10.0.0.2", "10.0.0.3"},
+			want:         "198.51.100.7",
+		},
+		{
+			name:         "Malformed hop",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"198.51.100.7, unknown, 10.0.0.2"},
+			want:         "10.0.0.2",
+		},
+		{
+			name:       "Trusted proxy without the header",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			assert.Equal(t, app.clientIP(r), tt.want)
+		})
+	}
+}
@@ -1,24 +1,47 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
+	"github.com/mhrdini/snippetbox/internal/models"
 	"github.com/mhrdini/snippetbox/ui"
 )
 
+// Routes of the metrics listener, kept apart from the application's routes so they're never
+// reachable on its address
+func metricsRoutes(m *appMetrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.registry.Handler())
+	return mux
+}
+
 func (app *application) routes() http.Handler {
 	// httprouter.New initialises a new servemux
-	// and is used to register handlers for a URL pattern
-	router := httprouter.New()
+	// and is used to register handlers for a URL pattern. It's wrapped so the request log and
+	// metrics know which pattern each request matched.
+	router := patternRouter{httprouter.New()}
 
 	// Createa handler function which wraps our app.notFound helper,
 	// then assign it as the custom handler for 404 Not Found responses.
 	// Can also be done for 405 Method Not Allowed using router.MethodNotAllowed.
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.apiNotFound(w)
+			return
+		}
 		app.notFound(w)
 	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.apiError(w, http.StatusMethodNotAllowed, fmt.Sprintf("the %s method is not supported for this resource", r.Method))
+			return
+		}
+		app.clientError(w, http.StatusMethodNotAllowed)
+	})
 
 	// Patterns may include:
 	// - :named parameters, as a wildcard
@@ -29,20 +52,69 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/static/*filepath", fs)
 
 	router.HandlerFunc(http.MethodGet, "/ping", ping)
+	router.HandlerFunc(http.MethodGet, "/healthz", app.healthz)
+	// Each readiness check queries the database and the session store, so unlike the other probes
+	// it's rate limited, per IP since it has no session
+	router.Handler(http.MethodGet, "/readyz", alice.New(app.rateLimit(app.rateLimiters.loose)).ThenFunc(app.readyz))
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	// Every page is rate limited by the loose policy, and routes a script could abuse by the strict
+	// one as well. Limits apply per user once authenticated, so they come after authenticate.
+	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate, app.rateLimit(app.rateLimiters.loose))
+	strict := dynamic.Append(app.rateLimit(app.rateLimiters.strict))
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/snippets", dynamic.ThenFunc(app.snippetList))
+	router.Handler(http.MethodGet, "/search", dynamic.ThenFunc(app.snippetSearch))
+	router.Handler(http.MethodGet, "/tags/:tag", dynamic.ThenFunc(app.tagView))
+	// The numeric URLs snippets had before slugs still lead to public ones
+	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetRedirectByID("")))
+	router.Handler(http.MethodGet, "/snippet/view/:id/history", dynamic.ThenFunc(app.snippetRedirectByID("/history")))
+	router.Handler(http.MethodGet, "/snippet/view/:id/diff", dynamic.ThenFunc(app.snippetRedirectByID("/diff")))
+	router.Handler(http.MethodGet, "/snippet/raw/:id", dynamic.ThenFunc(app.snippetRedirectByID("/raw")))
+	router.Handler(http.MethodGet, "/snippet/download/:id", dynamic.ThenFunc(app.snippetRedirectByID("/download")))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", dynamic.ThenFunc(app.snippetRedirectByID("/edit")))
+	router.Handler(http.MethodGet, "/s/:slug", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/s/:slug/history", dynamic.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/s/:slug/diff", dynamic.ThenFunc(app.snippetDiff))
+	router.Handler(http.MethodGet, "/s/:slug/raw", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/s/:slug/download", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodPost, "/s/:slug/unlock", strict.ThenFunc(app.snippetUnlockPost))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
-	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
+	router.Handler(http.MethodPost, "/user/signup", strict.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
-	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodPost, "/user/login", strict.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/password/forgot", dynamic.ThenFunc(app.userPasswordForgot))
+	router.Handler(http.MethodPost, "/user/password/forgot", strict.ThenFunc(app.userPasswordForgotPost))
+	router.Handler(http.MethodGet, "/user/password/reset", dynamic.ThenFunc(app.userPasswordReset))
+	router.Handler(http.MethodPost, "/user/password/reset", strict.ThenFunc(app.userPasswordResetPost))
 
 	protected := dynamic.Append(app.requireAuthentication)
 	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodPost, "/snippet/create", protected.Append(app.rateLimit(app.rateLimiters.strict)).ThenFunc(app.snippetCreatePost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/user/tokens", protected.ThenFunc(app.userTokens))
+	router.Handler(http.MethodPost, "/user/tokens", protected.ThenFunc(app.userTokensPost))
+	router.Handler(http.MethodPost, "/user/tokens/:id/revoke", protected.ThenFunc(app.userTokenRevokePost))
+
+	// Routes that act on an existing snippet are further restricted to the snippet's owner
+	owner := protected.Append(app.requireSnippetOwner)
+	router.Handler(http.MethodGet, "/s/:slug/edit", owner.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/s/:slug/edit", owner.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/s/:slug/delete", owner.ThenFunc(app.snippetDeletePost))
+	router.Handler(http.MethodPost, "/s/:slug/restore", owner.ThenFunc(app.snippetRestorePost))
+	router.Handler(http.MethodPost, "/s/:slug/burn", owner.ThenFunc(app.snippetBurnPost))
+
+	// JSON API, versioned so breaking changes can go in a new tree alongside it
+	// Bearer tokens are checked before the CSRF handler so token requests can be exempted from it
+	api := alice.New(app.sessionManager.LoadAndSave, app.authenticateToken, app.apiNoSurf, app.authenticate, app.rateLimit(app.rateLimiters.loose))
+	apiRead := api.Append(app.requireScope(models.ScopeRead))
+	router.Handler(http.MethodGet, "/api/v1/snippets", apiRead.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:slug", apiRead.ThenFunc(app.apiSnippetView))
+
+	apiWrite := api.Append(app.apiRequireAuthentication, app.requireScope(models.ScopeWrite), app.rateLimit(app.rateLimiters.strict))
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiWrite.ThenFunc(app.apiSnippetCreate))
 
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	// logRequest comes before recoverPanic so it sees the 500 recoverPanic writes when a handler
+	// panics, and requestID before both so they can log the request's ID
+	standard := alice.New(app.requestID, app.logRequest, app.recoverPanic, secureHeaders)
 	return standard.Then(router)
 }
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/mhrdini/snippetbox/internal/diff"
+	"github.com/mhrdini/snippetbox/internal/highlight"
 	"github.com/mhrdini/snippetbox/internal/models"
 	"github.com/mhrdini/snippetbox/ui"
 )
@@ -13,13 +20,45 @@ import (
 // Define a templateData type to act as the holding structure for any dynamic data
 // that we want to pass to our HTML templates.
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any // to pass the validation errors and previously submitted data back to the template when we redisplay the form
-	Toast           string
-	IsAuthenticated bool
-	CSRFToken       string // add hidden csrf_token input to each form tag for form submission to work, via template data when creating new template data
+	CurrentYear         int
+	Snippet             *models.Snippet
+	Snippets            []*models.Snippet
+	Revisions           []*models.Revision
+	Diff                *revisionDiff
+	Listing             *snippetListing
+	Search              *searchResults
+	Tag                 string
+	SnippetTags         []string
+	TagCloud            []*models.TagCount
+	Tokens              []*models.Token
+	NewToken            *models.Token // only set straight after creating a token, to show its plaintext once
+	Form                any           // to pass the validation errors and previously submitted data back to the template when we redisplay the form
+	Toast               string
+	IsAuthenticated     bool
+	AuthenticatedUserID int    // used to only show owner actions (edit, delete) on snippets the user created
+	CSRFToken           string // add hidden csrf_token input to each form tag for form submission to work, via template data when creating new template data
+}
+
+// Holds the two revisions being compared on the diff page, and the hunks of lines that differ
+type revisionDiff struct {
+	From  *models.Revision
+	To    *models.Revision
+	Hunks []diff.Hunk
+}
+
+// Holds the options of the current /snippets page and the URLs of the pages either side of it
+type snippetListing struct {
+	Sort     string
+	AuthorID int
+	Next     string
+	Prev     string
+}
+
+// Holds the query of the current search page and the URLs of the result pages either side of it
+type searchResults struct {
+	Query string
+	Next  string
+	Prev  string
 }
 
 func prettyDate(t time.Time) string {
@@ -32,8 +71,173 @@ func prettyDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// Describes how long until a snippet expires at t, e.g. "in 3 hours", or "Never" for the zero time
+func countdown(t time.Time) string {
+	if t.IsZero() {
+		return "Never"
+	}
+
+	d := time.Until(t)
+	switch {
+	case d < time.Minute:
+		return "in less than a minute"
+	case d < time.Hour:
+		return inUnits(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return inUnits(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		return inUnits(int(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		return inUnits(int(d/(30*24*time.Hour)), "month")
+	default:
+		return inUnits(int(d/(365*24*time.Hour)), "year")
+	}
+}
+
+func inUnits(n int, unit string) string {
+	if n == 1 {
+		return "in 1 " + unit
+	}
+	return fmt.Sprintf("in %d %ss", n, unit)
+}
+
+// How many bytes of context excerpt() shows before the first match, and in total
+const (
+	excerptLead   = 60
+	excerptLength = 240
+)
+
+// Returns a regexp matching any of the words in a search query, case-insensitively. Returns nil if
+// the query has no words.
+func termsRX(query string) *regexp.Regexp {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return nil
+	}
+
+	for i := range words {
+		words[i] = regexp.QuoteMeta(words[i])
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(words, "|"))
+}
+
+// Escapes text and wraps every match of rx in a <mark> element
+func markMatches(text string, rx *regexp.Regexp) template.HTML {
+	if rx == nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
+// Highlights the words of a search query wherever they appear in text
+func mark(text, query string) template.HTML {
+	return markMatches(text, termsRX(query))
+}
+
+// Returns a short window of content around the first word of query it contains, with the query's
+// words highlighted. Falls back to the start of content if none of the words appear in it.
+func excerpt(content, query string) template.HTML {
+	rx := termsRX(query)
+
+	start := 0
+	if rx != nil {
+		if loc := rx.FindStringIndex(content); loc != nil && loc[0] > excerptLead {
+			start = loc[0] - excerptLead
+		}
+	}
+
+	end := start + excerptLength
+	if end > len(content) {
+		end = len(content)
+	}
+
+	// Don't cut a multi-byte character in half
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end--
+	}
+
+	html := markMatches(content[start:end], rx)
+	if start > 0 {
+		html = "&hellip;" + html
+	}
+	if end < len(content) {
+		html += "&hellip;"
+	}
+
+	return html
+}
+
+// Reports whether value is one of values, for checking boxes of multi-valued form fields
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Renders content as syntax highlighted lines for a <pre> element. Each line is wrapped in a span
+// with an L<n> anchor and starts with its line number, which links to that anchor. Colours come
+// from the classes in main.css, never inline styles, to keep within the Content-Security-Policy.
+func highlightCode(language, content string) template.HTML {
+	// Browsers submit textarea newlines as CRLF
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	var b strings.Builder
+	for i, line := range highlight.Lines(highlight.Tokenize(language, content)) {
+		n := i + 1
+		fmt.Fprintf(&b, `<span class="line" id="L%d"><a class="ln" href="#L%d">%d</a>`, n, n, n)
+		for _, t := range line {
+			text := template.HTMLEscapeString(t.Text)
+			if class := t.Kind.Class(); class != "" {
+				fmt.Fprintf(&b, `<span class="%s">%s</span>`, class, text)
+			} else {
+				b.WriteString(text)
+			}
+		}
+		b.WriteString("</span>\n")
+	}
+
+	return template.HTML(b.String())
+}
+
+// Returns the display name of a language, e.g. "Go" for "go"
+func languageName(id string) string {
+	if l, ok := highlight.Find(id); ok {
+		return l.Name
+	}
+	return id
+}
+
 var functions = template.FuncMap{
-	"prettyDate": prettyDate,
+	"prettyDate":    prettyDate,
+	"contains":      contains,
+	"mark":          mark,
+	"excerpt":       excerpt,
+	"highlight":     highlightCode,
+	"languageName":  languageName,
+	"languages":     func() []highlight.Language { return highlight.Languages },
+	"countdown":     countdown,
+	"expiryOptions": func() []expiryOption { return expiryOptions },
 }
 
 // Caches all the templates in a map by using filepath.Glob() to get a slice of all pages
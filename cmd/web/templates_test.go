@@ -1,6 +1,8 @@
 package main
 
 import (
+	"html/template"
+	"strings"
 	"testing"
 	"time"
 
@@ -39,3 +41,117 @@ func TestPrettyDate(t *testing.T) {
 	}
 
 }
+
+func TestMark(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  template.HTML
+	}{
+		{
+			name:  "Case-insensitive",
+			text:  "An old silent Pond",
+			query: "pond",
+			want:  "An old silent <mark>Pond</mark>",
+		},
+		{
+			name:  "Escapes text",
+			text:  "<b>old</b> pond",
+			query: "old",
+			want:  "&lt;b&gt;<mark>old</mark>&lt;/b&gt; pond",
+		},
+		{
+			name:  "No words",
+			text:  "a+b",
+			query: "+",
+			want:  "a+b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, mark(tt.text, tt.query), tt.want)
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	content := strings.Repeat("x", 100) + " frog " + strings.Repeat("y", 300)
+
+	got := string(excerpt(content, "frog"))
+
+	assert.StringContains(t, got, "<mark>frog</mark>")
+	assert.Equal(t, strings.HasPrefix(got, "&hellip;"), true)
+	assert.Equal(t, strings.HasSuffix(got, "&hellip;"), true)
+	assert.Equal(t, string(excerpt("short", "frog")), "short")
+}
+
+func TestHighlightCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		content  string
+		want     template.HTML
+	}{
+		{
+			name:     "Numbered lines",
+			language: "text",
+			content:  "a\r\nb\r\n",
+			want: `<span class="line" id="L1"><a class="ln" href="#L1">1</a>a</span>` + "\n" +
+				`<span class="line" id="L2"><a class="ln" href="#L2">2</a>b</span>` + "\n",
+		},
+		{
+			name:     "Highlighted and escaped",
+			language: "go",
+			content:  `return "<b>"`,
+			want:     `<span class="line" id="L1"><a class="ln" href="#L1">1</a><span class="kw">return</span> <span class="str">&#34;&lt;b&gt;&#34;</span></span>` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, highlightCode(tt.language, tt.content), tt.want)
+		})
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	tests := []struct {
+		name string
+		tm   time.Time
+		want string
+	}{
+		{
+			name: "Never",
+			tm:   time.Time{},
+			want: "Never",
+		},
+		{
+			name: "Seconds",
+			tm:   time.Now().Add(30 * time.Second),
+			want: "in less than a minute",
+		},
+		{
+			name: "One hour",
+			tm:   time.Now().Add(time.Hour + time.Minute),
+			want: "in 1 hour",
+		},
+		{
+			name: "Days",
+			tm:   time.Now().Add(3*24*time.Hour + time.Minute),
+			want: "in 3 days",
+		},
+		{
+			name: "Years",
+			tm:   time.Now().AddDate(2, 0, 1),
+			want: "in 2 years",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, countdown(tt.tm), tt.want)
+		})
+	}
+}
@@ -4,17 +4,19 @@ import (
 	"bytes"
 	"html"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/mhrdini/snippetbox/internal/mailer"
 	"github.com/mhrdini/snippetbox/internal/models/mocks"
 )
 
@@ -54,12 +56,18 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Cookie.Secure = true
 
 	return &application{
-		// used in the errorLog and recoverPanic middleware used across all routes
-		// so we create dummy loggers so those functions won't panic
-		errorLog:       log.New(io.Discard, "", 0),
-		infoLog:        log.New(io.Discard, "", 0),
+		// used in the logRequest and recoverPanic middleware used across all routes
+		// so we create a dummy logger so those functions won't panic
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		metrics:        newAppMetrics(),
 		snippets:       &mocks.SnippetModel{},
+		revisions:      &mocks.RevisionModel{},
+		tokens:         &mocks.TokenModel{},
+		tags:           &mocks.TagModel{},
 		users:          &mocks.UserModel{},
+		passwordResets: &mocks.PasswordResetModel{},
+		mailer:         &mailer.Outbox{Sender: "Snippetbox <no-reply@snippetbox.test>"},
+		baseURL:        "https://snippetbox.test",
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
@@ -121,3 +129,47 @@ func (ts *testServer) postForm(t *testing.T, path string, form url.Values) (int,
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Logs in as the user that mocks.UserModel authenticates, leaving the authenticated session in
+// the test server client's cookie jar. Returns a CSRF token to use for subsequent form posts.
+func (ts *testServer) login(t *testing.T) string {
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", mocks.ValidEmail)
+	form.Add("password", mocks.ValidPassword)
+	form.Add("csrf_token", csrfToken)
+
+	status, _, _ := ts.postForm(t, "/user/login", form)
+	if status != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", status)
+	}
+
+	return csrfToken
+}
+
+// Sends a request with an arbitrary method, headers and body, for exercising the JSON API
+func (ts *testServer) do(t *testing.T, method, path string, header http.Header, body string) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range header {
+		req.Header[key] = value
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(b)
+}
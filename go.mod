@@ -1,6 +1,6 @@
 module github.com/mhrdini/snippetbox
 
-go 1.20
+go 1.21
 
 require (
 	github.com/go-sql-driver/mysql v1.7.1
@@ -16,4 +16,8 @@ require (
 
 require golang.org/x/crypto v0.23.0
 
-require github.com/justinas/nosurf v1.1.1 // indirect
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/justinas/nosurf v1.1.1
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,241 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Above this many cells the LCS table gets too big to build per request, so the changed middle
+// section is reported as a straight delete followed by an insert instead.
+const maxTableCells = 4_000_000
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+type Line struct {
+	Op     Op
+	Text   string
+	OldNum int // line number in the old text, 0 for inserted lines
+	NewNum int // line number in the new text, 0 for deleted lines
+}
+
+// Prefix returns the marker used for the line in unified diff output.
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Delete:
+		return "-"
+	case Insert:
+		return "+"
+	default:
+		return " "
+	}
+}
+
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header returns the hunk range header, e.g. "@@ -1,3 +1,4 @@".
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Lines returns a line-by-line diff turning a into b, using the longest common subsequence of
+// lines so unchanged lines are kept as Equal.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+
+	// Trim the common prefix and suffix first, edits are usually small and local so this keeps the
+	// LCS table tiny for most diffs
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	ops := make([]Op, 0, len(x)+len(y))
+	for i := 0; i < pre; i++ {
+		ops = append(ops, Equal)
+	}
+	ops = append(ops, lcs(x[pre:len(x)-suf], y[pre:len(y)-suf])...)
+	for i := 0; i < suf; i++ {
+		ops = append(ops, Equal)
+	}
+
+	lines := make([]Line, 0, len(ops))
+	i, j := 0, 0
+	for _, op := range ops {
+		switch op {
+		case Equal:
+			lines = append(lines, Line{Op: Equal, Text: x[i], OldNum: i + 1, NewNum: j + 1})
+			i++
+			j++
+		case Delete:
+			lines = append(lines, Line{Op: Delete, Text: x[i], OldNum: i + 1})
+			i++
+		case Insert:
+			lines = append(lines, Line{Op: Insert, Text: y[j], NewNum: j + 1})
+			j++
+		}
+	}
+
+	return lines
+}
+
+// Unified groups the changes between a and b into hunks with up to context unchanged lines
+// around each change. Returns nil if the texts have identical lines.
+func Unified(a, b string, context int) []Hunk {
+	lines := Lines(a, b)
+
+	// Find [start, end) ranges of lines to show, merging changes whose context would overlap
+	type span struct{ start, end int }
+	var spans []span
+	for k, l := range lines {
+		if l.Op == Equal {
+			continue
+		}
+
+		start := k - context
+		if start < 0 {
+			start = 0
+		}
+		end := k + context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		if n := len(spans); n > 0 && start <= spans[n-1].end {
+			spans[n-1].end = end
+		} else {
+			spans = append(spans, span{start, end})
+		}
+	}
+
+	hunks := make([]Hunk, 0, len(spans))
+	for _, sp := range spans {
+		h := Hunk{Lines: lines[sp.start:sp.end]}
+
+		// Count the old and new lines that come before the hunk to find where it starts
+		oldBefore, newBefore := 0, 0
+		for _, l := range lines[:sp.start] {
+			if l.Op != Insert {
+				oldBefore++
+			}
+			if l.Op != Delete {
+				newBefore++
+			}
+		}
+
+		for _, l := range h.Lines {
+			if l.Op != Insert {
+				h.OldLines++
+			}
+			if l.Op != Delete {
+				h.NewLines++
+			}
+		}
+
+		// An empty range starts at the line before it, as in GNU diff
+		h.OldStart = oldBefore
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		h.NewStart = newBefore
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+
+		hunks = append(hunks, h)
+	}
+
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	return hunks
+}
+
+// lcs returns the edit operations turning x into y, with deletions ordered before insertions
+// within each changed block.
+func lcs(x, y []string) []Op {
+	n, m := len(x), len(y)
+
+	if (n+1)*(m+1) > maxTableCells {
+		ops := make([]Op, 0, n+m)
+		for i := 0; i < n; i++ {
+			ops = append(ops, Delete)
+		}
+		for j := 0; j < m; j++ {
+			ops = append(ops, Insert)
+		}
+		return ops
+	}
+
+	// table[i][j] holds the length of the LCS of x[i:] and y[j:]
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else if table[i+1][j] >= table[i][j+1] {
+				table[i][j] = table[i+1][j]
+			} else {
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]Op, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			ops = append(ops, Equal)
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			ops = append(ops, Delete)
+			i++
+		default:
+			ops = append(ops, Insert)
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, Delete)
+	}
+	for ; j < m; j++ {
+		ops = append(ops, Insert)
+	}
+
+	return ops
+}
+
+// split breaks text into lines, ignoring a single trailing newline so "a\n" and "a" compare equal
+// line-wise. Windows line endings are normalised first.
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+// render formats hunks the way `diff -u` prints them, minus the file headers
+func render(hunks []Hunk) string {
+	var b strings.Builder
+	for _, h := range hunks {
+		b.WriteString(h.Header() + "\n")
+		for _, l := range h.Lines {
+			b.WriteString(l.Prefix() + l.Text + "\n")
+		}
+	}
+	return b.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       string
+		b       string
+		context int
+		want    string
+	}{
+		{
+			name:    "Identical",
+			a:       "a\nb\nc",
+			b:       "a\nb\nc\n",
+			context: 3,
+			want:    "",
+		},
+		{
+			name:    "Changed line",
+			a:       "a\nb\nc",
+			b:       "a\nB\nc",
+			context: 1,
+			want:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "Insert into empty",
+			a:       "",
+			b:       "a\nb",
+			context: 3,
+			want:    "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "Separate hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8",
+			b:       "one\n2\n3\n4\n5\n6\n7\neight",
+			context: 1,
+			want:    "@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+eight\n",
+		},
+		{
+			name:    "Merged hunks",
+			a:       "1\n2\n3\n4",
+			b:       "one\n2\n3\nfour",
+			context: 1,
+			want:    "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n-4\n+four\n",
+		},
+		{
+			name:    "Deleted middle",
+			a:       "a\nb\nc\nd",
+			b:       "a\nd",
+			context: 0,
+			want:    "@@ -2,2 +1,0 @@\n-b\n-c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := render(Unified(tt.a, tt.b, tt.context))
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestLinesNumbering(t *testing.T) {
+	lines := Lines("a\nb", "b\nc")
+
+	want := []Line{
+		{Op: Delete, Text: "a", OldNum: 1},
+		{Op: Equal, Text: "b", OldNum: 2, NewNum: 1},
+		{Op: Insert, Text: "c", NewNum: 2},
+	}
+
+	assert.Equal(t, len(lines), len(want))
+	for i := range want {
+		assert.Equal(t, lines[i], want[i])
+	}
+}
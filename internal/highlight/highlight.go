@@ -0,0 +1,378 @@
+// Package highlight splits source code into tokens for syntax highlighting. It knows just enough
+// of each language's lexical structure (comments, strings, numbers, keywords) to colour a
+// snippet, it is not a parser.
+package highlight
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind is the lexical class of a token
+type Kind int
+
+const (
+	Plain Kind = iota
+	Keyword
+	String
+	Number
+	Comment
+	Key // a mapping key, in YAML
+)
+
+// Class returns the CSS class for tokens of kind k, or an empty string for plain text
+func (k Kind) Class() string {
+	switch k {
+	case Keyword:
+		return "kw"
+	case String:
+		return "str"
+	case Number:
+		return "num"
+	case Comment:
+		return "com"
+	case Key:
+		return "key"
+	default:
+		return ""
+	}
+}
+
+type Token struct {
+	Kind Kind
+	Text string
+}
+
+// Identifiers of the supported languages, Text is not highlighted at all
+const (
+	Text = "text"
+	Go   = "go"
+	SQL  = "sql"
+	YAML = "yaml"
+)
+
+// Language is a language a snippet can be highlighted as, with a name to show in forms and the
+// extension to give files written in it
+type Language struct {
+	ID   string
+	Name string
+	Ext  string
+}
+
+// Languages lists the supported languages in the order they should be offered
+var Languages = []Language{
+	{ID: Text, Name: "Plain text", Ext: ".txt"},
+	{ID: Go, Name: "Go", Ext: ".go"},
+	{ID: SQL, Name: "SQL", Ext: ".sql"},
+	{ID: YAML, Name: "YAML", Ext: ".yaml"},
+}
+
+// Find returns the language in Languages with the given id
+func Find(id string) (Language, bool) {
+	for _, l := range Languages {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return Language{}, false
+}
+
+// Valid reports whether id is one of Languages
+func Valid(id string) bool {
+	_, ok := Find(id)
+	return ok
+}
+
+// The lexical rules of a language
+type syntax struct {
+	lineComments []string
+	blockComment [2]string // opening and closing delimiters, empty if there are none
+	quotes       string    // characters that open a string closed by the same character
+	rawQuotes    string    // like quotes but without escapes, and may span lines
+	keywords     map[string]bool
+	foldCase     bool // keywords are case-insensitive and listed in lower case
+	keys         bool // mapping keys at the start of a line are tokens of their own
+}
+
+func words(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var syntaxes = map[string]*syntax{
+	Go: {
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		rawQuotes:    "`",
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto
+			if import interface map package range return select struct switch type var
+			true false nil iota`),
+	},
+	SQL: {
+		lineComments: []string{"--", "#"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+		rawQuotes:    "`",
+		keywords: words(`add all alter and as asc auto_increment between by cascade case check column
+			constraint create cross current_timestamp database default delete desc distinct drop
+			else end exists foreign from full group having if in index inner insert into is join key
+			left like limit not null offset on or order outer primary references right select set
+			table then truncate union unique update using values view when where with
+			integer int bigint smallint varchar char text blob datetime timestamp date boolean
+			decimal float double true false`),
+		foldCase: true,
+	},
+	YAML: {
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords:     words(`true false yes no on off null ~`),
+		keys:         true,
+	},
+}
+
+// Matches a YAML mapping key at the start of a line: indentation, an optional list item dash,
+// the key and its colon
+var keyRX = regexp.MustCompile(`^([ \t]*(?:-[ \t]+)?)([^\s#'"\-][^:#\n]*?)[ \t]*:(?:[ \t]|$|\n)`)
+
+// Tokenize splits src into tokens according to the rules of language. Concatenating the tokens'
+// text gives back src exactly. Unknown languages and Text come back as a single Plain token.
+func Tokenize(language, src string) []Token {
+	syn, ok := syntaxes[language]
+	if !ok {
+		if src == "" {
+			return nil
+		}
+		return []Token{{Kind: Plain, Text: src}}
+	}
+
+	var tokens []Token
+	emit := func(kind Kind, text string) {
+		if text == "" {
+			return
+		}
+		// Merge runs of plain text so the output isn't a span per character
+		if n := len(tokens); n > 0 && kind == Plain && tokens[n-1].Kind == Plain {
+			tokens[n-1].Text += text
+			return
+		}
+		tokens = append(tokens, Token{Kind: kind, Text: text})
+	}
+
+	i := 0
+	lineStart := true
+	for i < len(src) {
+		rest := src[i:]
+
+		if syn.keys && lineStart {
+			if m := keyRX.FindStringSubmatchIndex(rest); m != nil {
+				emit(Plain, rest[m[2]:m[3]])
+				emit(Key, rest[m[4]:m[5]])
+				i += m[5]
+				lineStart = false
+				continue
+			}
+		}
+
+		if prefix, ok := hasAnyPrefix(rest, syn.lineComments); ok {
+			// A # only starts a comment where it can't be part of a word, e.g. not in YAML's a#b
+			if prefix != "#" || i == 0 || !isWordByte(src[i-1]) {
+				end := strings.IndexByte(rest, '\n')
+				if end < 0 {
+					end = len(rest)
+				}
+				emit(Comment, rest[:end])
+				i += end
+				continue
+			}
+		}
+
+		if open := syn.blockComment[0]; open != "" && strings.HasPrefix(rest, open) {
+			end := strings.Index(rest[len(open):], syn.blockComment[1])
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += len(open) + len(syn.blockComment[1])
+			}
+			emit(Comment, rest[:end])
+			i += end
+			lineStart = strings.HasSuffix(rest[:end], "\n")
+			continue
+		}
+
+		c := rest[0]
+
+		if strings.IndexByte(syn.rawQuotes, c) >= 0 {
+			end := strings.IndexByte(rest[1:], c)
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 2
+			}
+			emit(String, rest[:end])
+			i += end
+			lineStart = false
+			continue
+		}
+
+		if strings.IndexByte(syn.quotes, c) >= 0 {
+			end := scanString(rest)
+			emit(String, rest[:end])
+			i += end
+			lineStart = false
+			continue
+		}
+
+		if isDigit(c) || (c == '-' && len(rest) > 1 && isDigit(rest[1]) && (i == 0 || !isWordByte(src[i-1]))) {
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			emit(Number, rest[:end])
+			i += end
+			lineStart = false
+			continue
+		}
+
+		if isWordStart(rest) {
+			end := 0
+			for end < len(rest) {
+				r, size := utf8.DecodeRuneInString(rest[end:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				end += size
+			}
+			word := rest[:end]
+			key := word
+			if syn.foldCase {
+				key = strings.ToLower(word)
+			}
+			if syn.keywords[key] {
+				emit(Keyword, word)
+			} else {
+				emit(Plain, word)
+			}
+			i += end
+			lineStart = false
+			continue
+		}
+
+		if c == '~' && syn.keywords["~"] {
+			emit(Keyword, "~")
+			i++
+			lineStart = false
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		emit(Plain, rest[:size])
+		i += size
+		lineStart = c == '\n'
+	}
+
+	return tokens
+}
+
+// Lines splits tokens at newlines, so each line can be rendered on its own. The newlines
+// themselves are dropped, a trailing newline doesn't start another line, and there is always at
+// least one line.
+func Lines(tokens []Token) [][]Token {
+	lines := [][]Token{nil}
+	for _, t := range tokens {
+		parts := strings.Split(t.Text, "\n")
+		for j, part := range parts {
+			if j > 0 {
+				lines = append(lines, nil)
+			}
+			if part != "" {
+				n := len(lines) - 1
+				lines[n] = append(lines[n], Token{Kind: t.Kind, Text: part})
+			}
+		}
+	}
+	if n := len(lines); n > 1 && lines[n-1] == nil {
+		lines = lines[:n-1]
+	}
+	return lines
+}
+
+// Returns the length of the quoted string at the start of s, which ends at the matching quote,
+// the end of the line or the end of s. Backslash escapes the next character.
+func scanString(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		}
+	}
+	return len(s)
+}
+
+func hasAnyPrefix(s string, prefixes []string) (string, bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isWordStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+var (
+	goRX   = regexp.MustCompile(`(?m)^package \w+$|^func [\w(]|:= `)
+	sqlRX  = regexp.MustCompile(`(?i)^\s*(SELECT|INSERT|UPDATE|DELETE|CREATE|ALTER|DROP|WITH)\b`)
+	yamlRX = regexp.MustCompile(`(?m)^[ \t]*(?:-[ \t]+)?[\w.-]+:(?:[ \t]|$)`)
+)
+
+// Detect guesses the language of src, falling back to Text
+func Detect(src string) string {
+	switch {
+	case goRX.MatchString(src):
+		return Go
+	case sqlRX.MatchString(src):
+		return SQL
+	case strings.HasPrefix(src, "---\n"):
+		return YAML
+	}
+
+	// Call it YAML if most non-blank, non-comment lines look like keys or list items
+	var lines, keys int
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lines++
+		if yamlRX.MatchString(line) || strings.HasPrefix(trimmed, "- ") {
+			keys++
+		}
+	}
+	if lines > 0 && keys*2 > lines {
+		return YAML
+	}
+
+	return Text
+}
@@ -0,0 +1,163 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+// Joins the tokens of the given kind, separated by |
+func ofKind(tokens []Token, kind Kind) string {
+	var texts []string
+	for _, t := range tokens {
+		if t.Kind == kind {
+			texts = append(texts, t.Text)
+		}
+	}
+	return strings.Join(texts, "|")
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		src      string
+		kind     Kind
+		want     string
+	}{
+		{
+			name:     "Go keywords",
+			language: Go,
+			src:      "func main() {\n\treturn nil\n}",
+			kind:     Keyword,
+			want:     "func|return|nil",
+		},
+		{
+			name:     "Go strings",
+			language: Go,
+			src:      "s := \"a \\\"quoted\\\" word\" + `raw\nstring`",
+			kind:     String,
+			want:     "\"a \\\"quoted\\\" word\"|`raw\nstring`",
+		},
+		{
+			name:     "Go comments",
+			language: Go,
+			src:      "x := 1 // one\n/* two\nlines */ y := 2",
+			kind:     Comment,
+			want:     "// one|/* two\nlines */",
+		},
+		{
+			name:     "Go numbers",
+			language: Go,
+			src:      "x1 := 0x1F + 3.14 - v2",
+			kind:     Number,
+			want:     "0x1F|3.14",
+		},
+		{
+			name:     "SQL keywords are case-insensitive",
+			language: SQL,
+			src:      "SELECT id FROM snippets where id = 1",
+			kind:     Keyword,
+			want:     "SELECT|FROM|where",
+		},
+		{
+			name:     "SQL comments",
+			language: SQL,
+			src:      "-- note\nSELECT 1; # other",
+			kind:     Comment,
+			want:     "-- note|# other",
+		},
+		{
+			name:     "YAML keys",
+			language: YAML,
+			src:      "name: snippetbox\nservices:\n  - image: mysql:8\n    port: 3306",
+			kind:     Key,
+			want:     "name|services|image|port",
+		},
+		{
+			name:     "YAML comments",
+			language: YAML,
+			src:      "url: http://a#b # trailing\n# whole line",
+			kind:     Comment,
+			want:     "# trailing|# whole line",
+		},
+		{
+			name:     "Plain text",
+			language: Text,
+			src:      "func main() {}",
+			kind:     Plain,
+			want:     "func main() {}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := Tokenize(tt.language, tt.src)
+			assert.Equal(t, ofKind(tokens, tt.kind), tt.want)
+
+			// Tokens must always add back up to the source
+			var b strings.Builder
+			for _, tok := range tokens {
+				b.WriteString(tok.Text)
+			}
+			assert.Equal(t, b.String(), tt.src)
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	lines := Lines(Tokenize(Go, "/* a\nb */\nx\n"))
+
+	assert.Equal(t, len(lines), 3)
+	assert.Equal(t, lines[0][0], Token{Kind: Comment, Text: "/* a"})
+	assert.Equal(t, lines[1][0], Token{Kind: Comment, Text: "b */"})
+	assert.Equal(t, lines[2][0], Token{Kind: Plain, Text: "x"})
+
+	assert.Equal(t, len(Lines(nil)), 1)
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Go package",
+			src:  "package main\n\nimport \"fmt\"",
+			want: Go,
+		},
+		{
+			name: "Go function",
+			src:  "func add(a, b int) int {\n\treturn a + b\n}",
+			want: Go,
+		},
+		{
+			name: "SQL",
+			src:  "  select * from snippets;",
+			want: SQL,
+		},
+		{
+			name: "YAML document",
+			src:  "---\nfoo",
+			want: YAML,
+		},
+		{
+			name: "YAML mapping",
+			src:  "# config\nname: web\nports:\n  - 4000\n",
+			want: YAML,
+		},
+		{
+			name: "Prose",
+			src:  "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+			want: Text,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Detect(tt.src), tt.want)
+		})
+	}
+}
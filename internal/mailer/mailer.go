@@ -0,0 +1,73 @@
+// Package mailer sends plain text email, either over SMTP or into an outbox that keeps the messages
+// for development and tests.
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMessage is returned by Send for a message that can't be sent as it is, e.g. one whose
+// recipient isn't an email address
+var ErrInvalidMessage = errors.New("mailer: invalid message")
+
+// Message is a plain text email to a single recipient
+type Message struct {
+	To      string // an address, optionally with a name, e.g. "Astarion <lilstar@bg3.com>"
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages from a sender it's configured with
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Formats msg from sender as it goes over the wire, with CRLF line endings and the body quoted-
+// printable encoded, so it's safe whatever characters it contains
+func compose(sender string, msg Message, date time.Time) ([]byte, error) {
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return nil, fmt.Errorf("%w: sender: %v", ErrInvalidMessage, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recipient: %v", ErrInvalidMessage, err)
+	}
+	// Line breaks in the subject would let it add headers of its own
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("%w: subject contains a line break", ErrInvalidMessage)
+	}
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&b)
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	_, err = w.Write([]byte(body))
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
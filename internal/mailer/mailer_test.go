@@ -0,0 +1,208 @@
+package mailer
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+const testSender = "Snippetbox <no-reply@snippetbox.test>"
+
+func TestCompose(t *testing.T) {
+	date := time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)
+	msg := Message{
+		To:      "Astarion <lilstar@bg3.com>",
+		Subject: "Réinitialiser",
+		Body:    "Hello,\nfollow https://snippetbox.test/user/password/reset?token=abc\n",
+	}
+
+	b, err := compose(testSender, msg, date)
+	assert.NilError(t, err)
+
+	want := "From: \"Snippetbox\" <no-reply@snippetbox.test>\r\n" +
+		"To: \"Astarion\" <lilstar@bg3.com>\r\n" +
+		"Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n" +
+		"Date: Fri, 07 Jun 2024 10:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Hello,\r\n" +
+		"follow https://snippetbox.test/user/password/reset?token=3Dabc\r\n"
+	assert.Equal(t, string(b), want)
+}
+
+func TestComposeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender string
+		msg    Message
+	}{
+		{
+			name:   "Bad sender",
+			sender: "snippetbox",
+			msg:    Message{To: "lilstar@bg3.com", Subject: "Hello"},
+		},
+		{
+			name:   "Bad recipient",
+			sender: testSender,
+			msg:    Message{To: "lilstar", Subject: "Hello"},
+		},
+		{
+			name:   "Header injection in recipient",
+			sender: testSender,
+			msg:    Message{To: "lilstar@bg3.com\r\nBcc: everyone@bg3.com", Subject: "Hello"},
+		},
+		{
+			name:   "Header injection in subject",
+			sender: testSender,
+			msg:    Message{To: "lilstar@bg3.com", Subject: "Hello\r\nBcc: everyone@bg3.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compose(tt.sender, tt.msg, time.Now())
+			assert.Equal(t, errors.Is(err, ErrInvalidMessage), true)
+		})
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	o := &Outbox{Dir: dir, Sender: testSender}
+
+	first := Message{To: "lilstar@bg3.com", Subject: "First", Body: "One"}
+	second := Message{To: "lilstar@bg3.com", Subject: "Second", Body: "Two"}
+	assert.NilError(t, o.Send(first))
+	assert.NilError(t, o.Send(second))
+
+	err := o.Send(Message{To: "lilstar", Subject: "Invalid"})
+	assert.Equal(t, errors.Is(err, ErrInvalidMessage), true)
+
+	// Written messages aren't kept in memory as well, or a long-running server would pile them up
+	assert.Equal(t, len(o.Messages()), 0)
+
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+
+	b, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	assert.NilError(t, err)
+	assert.StringContains(t, string(b), "Subject: First\r\n")
+	b, err = os.ReadFile(filepath.Join(dir, entries[1].Name()))
+	assert.NilError(t, err)
+	assert.StringContains(t, string(b), "Subject: Second\r\n")
+
+	info, err := entries[0].Info()
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0o600))
+}
+
+func TestOutboxInMemory(t *testing.T) {
+	o := &Outbox{Sender: testSender}
+	msg := Message{To: "lilstar@bg3.com", Subject: "Hello"}
+	assert.NilError(t, o.Send(msg))
+
+	messages := o.Messages()
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0], msg)
+}
+
+func TestSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go fakeSMTPServer(ln, received)
+
+	addr := ln.Addr().(*net.TCPAddr)
+	m := &SMTP{Host: "127.0.0.1", Port: addr.Port, Sender: testSender, Timeout: 5 * time.Second}
+
+	err = m.Send(Message{To: "Astarion <lilstar@bg3.com>", Subject: "Hello", Body: ".leading dot\n"})
+	assert.NilError(t, err)
+
+	var commands []string
+	select {
+	case commands = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server never got the message")
+	}
+
+	transcript := strings.Join(commands, "\n")
+	assert.StringContains(t, transcript, "MAIL FROM:<no-reply@snippetbox.test>")
+	assert.StringContains(t, transcript, "RCPT TO:<lilstar@bg3.com>")
+	assert.StringContains(t, transcript, "Subject: Hello")
+	// Lines starting with a dot are doubled up, so they aren't taken for the end of the message
+	assert.StringContains(t, transcript, "..leading dot")
+}
+
+func TestSMTPUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := &SMTP{Host: "127.0.0.1", Port: port, Sender: testSender, Timeout: time.Second}
+	err = m.Send(Message{To: "lilstar@bg3.com", Subject: "Hello"})
+	if err == nil {
+		t.Error("got: nil; expected an error")
+	}
+}
+
+// Accepts one connection and plays along with just enough SMTP to take a message, sending every
+// line the client wrote to received once the client quits
+func fakeSMTPServer(ln net.Listener, received chan<- []string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	var lines []string
+	inData := false
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		if inData {
+			if line == "." {
+				inData = false
+				reply("250 OK")
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			reply("250 localhost")
+		case strings.HasPrefix(line, "DATA"):
+			inData = true
+			reply("354 Go ahead")
+		case strings.HasPrefix(line, "QUIT"):
+			reply("221 Bye")
+			received <- lines
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox keeps the messages it's asked to send instead of sending them, for development and tests.
+// If Dir is set each message is written there, as an .eml file any mail client can open. Otherwise
+// it's kept in memory, which is only meant for tests, since nothing ever clears it.
+type Outbox struct {
+	Dir    string
+	Sender string
+
+	mu       sync.Mutex
+	messages []Message
+	written  int // messages written to Dir
+}
+
+// Send writes msg to Dir if it's set, or keeps it in memory if not
+func (o *Outbox) Send(msg Message) error {
+	now := time.Now()
+	b, err := compose(o.Sender, msg, now)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.Dir != "" {
+		// Messages may hold secrets, such as password reset links, so only the owner can read them
+		err = os.MkdirAll(o.Dir, 0o700)
+		if err != nil {
+			return err
+		}
+
+		// The count tells apart messages sent in the same instant and keeps them in order
+		name := fmt.Sprintf("%s-%04d.eml", now.UTC().Format("20060102T150405.000000000Z"), o.written)
+		err = os.WriteFile(filepath.Join(o.Dir, name), b, 0o600)
+		if err != nil {
+			return err
+		}
+		o.written++
+		return nil
+	}
+
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns the messages kept in memory, oldest first. It's always empty when Dir is set.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
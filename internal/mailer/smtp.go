@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// How long SMTP gives a message altogether, from connecting to the server to it accepting the
+// message, if Timeout isn't set
+const defaultSMTPTimeout = 10 * time.Second
+
+// SMTP sends messages through an SMTP server, upgrading the connection with STARTTLS whenever the
+// server offers it
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string // empty to send without authenticating
+	Password string
+	Sender   string // the From address, optionally with a name, e.g. "Snippetbox <no-reply@example.com>"
+	Timeout  time.Duration
+}
+
+// Send delivers msg to the server, returning once the server has accepted it
+func (m *SMTP) Send(msg Message) error {
+	b, err := compose(m.Sender, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	// Both parse, compose has checked
+	from, _ := mail.ParseAddress(m.Sender)
+	to, _ := mail.ParseAddress(msg.To)
+
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(m.Host, strconv.Itoa(m.Port)), timeout)
+	if err != nil {
+		return err
+	}
+	// net/smtp has no timeouts of its own, so the deadline covers the whole conversation
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: m.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	// PlainAuth refuses to send the password over a connection that isn't encrypted, unless the
+	// server is on localhost
+	if m.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(to.Address)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+
+	requests := reg.NewCounter("requests_total", "Requests served.", "method", "status")
+	requests.Inc("POST", "303")
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+
+	reg.NewGauge("in_flight", "Requests being served.")
+
+	durations := reg.NewHistogram("duration_seconds", "How long requests took.", []float64{1, 0.1}, "route")
+	durations.Observe(0.05, "/")
+	durations.Observe(0.1, "/")
+	durations.Observe(3, "/")
+
+	reg.NewGaugeFunc("connections", "Open connections.", func() float64 { return 4 })
+
+	labels := reg.NewCounter("escaped_total", "Backslash \\ and\nnewline.", "value")
+	labels.Inc("a \"quoted\"\\path\n")
+
+	var b strings.Builder
+	err := reg.WriteText(&b)
+	assert.NilError(t, err)
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 3
+requests_total{method="POST",status="303"} 1
+# HELP in_flight Requests being served.
+# TYPE in_flight gauge
+in_flight 0
+# HELP duration_seconds How long requests took.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/",le="0.1"} 2
+duration_seconds_bucket{route="/",le="1"} 2
+duration_seconds_bucket{route="/",le="+Inf"} 3
+duration_seconds_sum{route="/"} 3.15
+duration_seconds_count{route="/"} 3
+# HELP connections Open connections.
+# TYPE connections gauge
+connections 4
+# HELP escaped_total Backslash \\ and\nnewline.
+# TYPE escaped_total counter
+escaped_total{value="a \"quoted\"\\path\n"} 1
+`
+	assert.Equal(t, b.String(), want)
+}
+
+func TestGauge(t *testing.T) {
+	reg := NewRegistry()
+	g := reg.NewGauge("in_flight", "Requests being served.")
+
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	var b strings.Builder
+	err := reg.WriteText(&b)
+	assert.NilError(t, err)
+	assert.StringContains(t, b.String(), "\nin_flight 1\n")
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("requests_total", "Requests served.", "method")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	c.Inc("GET", "200")
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cursor marks a position in a keyset-paginated listing: the sort key and ID of the row at the
+// edge of a page, and whether the next request moves forwards (after it) or backwards (before it)
+type cursor struct {
+	Backward bool
+	Key      time.Time
+	ID       int
+}
+
+// encode returns the cursor as an opaque URL-safe string
+func (c cursor) encode() string {
+	dir := "n"
+	if c.Backward {
+		dir = "p"
+	}
+
+	raw := fmt.Sprintf("%s|%d|%d", dir, c.Key.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || (parts[0] != "n" && parts[0] != "p") {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	id, err := strconv.Atoi(parts[2])
+	if err != nil || id < 1 {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return cursor{
+		Backward: parts[0] == "p",
+		Key:      time.Unix(0, nanos).UTC(),
+		ID:       id,
+	}, nil
+}
+
+// encodeOffset returns an opaque cursor for offset-paginated listings like search results, whose
+// ordering (relevance) isn't a stable key to paginate on
+func encodeOffset(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("o|%d", offset)))
+}
+
+func decodeOffset(s string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	n, ok := strings.CutPrefix(string(raw), "o|")
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+
+	offset, err := strconv.Atoi(n)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return offset, nil
+}
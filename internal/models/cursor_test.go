@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := cursor{
+		Backward: true,
+		Key:      time.Date(2024, 6, 2, 3, 27, 0, 0, time.UTC),
+		ID:       42,
+	}
+
+	got, err := decodeCursor(want.encode())
+
+	assert.NilError(t, err)
+	assert.Equal(t, got, want)
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "Not base64", cursor: "!!!"},
+		{name: "Wrong parts", cursor: cursor{ID: 1}.encode()[:4]},
+		{name: "Zero ID", cursor: cursor{Key: time.Now()}.encode()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor)
+			assert.Equal(t, err, ErrInvalidCursor)
+		})
+	}
+}
+
+func TestOffsetRoundTrip(t *testing.T) {
+	got, err := decodeOffset(encodeOffset(40))
+
+	assert.NilError(t, err)
+	assert.Equal(t, got, 40)
+
+	_, err = decodeOffset(cursor{ID: 1}.encode())
+	assert.Equal(t, err, ErrInvalidCursor)
+}
@@ -6,4 +6,7 @@ var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrInvalidCursor      = errors.New("models: invalid cursor")
+	ErrGone               = errors.New("models: snippet has been burned")
+	ErrTooManyAttempts    = errors.New("models: too many failed attempts")
 )
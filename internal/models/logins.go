@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Outcomes of login attempts, as recorded in login_attempts
+const (
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+	LoginLocked    = "locked" // refused without checking the password, during a lockout
+	LoginReset     = "reset"  // not a login, the password was changed, which ends a lockout like success does
+)
+
+// Throttling of failed logins by Authenticate. An account is locked after maxAccountFailures
+// failures since its last successful login or password change, and an IP address after
+// maxIPFailures failures in ipFailureWindow, whichever account they were for. Each further failure
+// doubles the lockout, up to maxLoginLockout.
+const (
+	maxAccountFailures   = 5
+	accountFailureWindow = 24 * time.Hour
+	maxIPFailures        = 20
+	ipFailureWindow      = time.Hour
+	minLoginLockout      = time.Minute
+	maxLoginLockout      = time.Hour
+)
+
+// LockoutError is returned by Authenticate while the account or IP address is locked after too
+// many failed logins. It wraps ErrTooManyAttempts.
+type LockoutError struct {
+	Until time.Time
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s, locked until %s", ErrTooManyAttempts, e.Until.Format(time.RFC3339))
+}
+
+func (e *LockoutError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// Returns when logins for email from ip will be allowed again, or the zero time if they're allowed
+// now, counting only the attempts recorded before the one with ID attempt. Account failures count
+// from the last successful login or password change. IP failures aren't reset by either, or
+// logging in to an account of one's own would let a guesser carry on.
+func loginLockedUntil(db *sql.DB, email, ip string, attempt int64) (time.Time, error) {
+	stmt := `SELECT COUNT(*), MAX(created) FROM login_attempts
+	WHERE email = ? AND result = ? AND created > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND) AND id < ?
+	AND id > (SELECT COALESCE(MAX(id), 0) FROM login_attempts WHERE email = ? AND result IN (?, ?) AND id < ?)`
+
+	var accountFailures int
+	var accountLast sql.NullTime
+	err := db.QueryRow(stmt, email, LoginFailed, int(accountFailureWindow.Seconds()), attempt, email, LoginSucceeded, LoginReset, attempt).
+		Scan(&accountFailures, &accountLast)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	stmt = `SELECT COUNT(*), MAX(created) FROM login_attempts
+	WHERE ip = ? AND result = ? AND created > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND) AND id < ?`
+
+	var ipFailures int
+	var ipLast sql.NullTime
+	err = db.QueryRow(stmt, ip, LoginFailed, int(ipFailureWindow.Seconds()), attempt).Scan(&ipFailures, &ipLast)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return latestLockout(
+		lockedUntil(accountFailures, accountLast.Time, maxAccountFailures),
+		lockedUntil(ipFailures, ipLast.Time, maxIPFailures),
+	), nil
+}
+
+// Returns when a lockout that started with the last of the given failures runs out, or the zero
+// time if there haven't been threshold of them
+func lockedUntil(failures int, last time.Time, threshold int) time.Time {
+	if failures < threshold {
+		return time.Time{}
+	}
+	return last.Add(backoff(failures, threshold, minLoginLockout, maxLoginLockout))
+}
+
+func latestLockout(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Records a login attempt for email from ip, returning its ID. userID is 0 when there's no
+// account with that email.
+func recordLogin(db *sql.DB, email string, userID int, ip, result string) (int64, error) {
+	stmt := `INSERT INTO login_attempts (email, user_id, ip, result, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	var id sql.NullInt64
+	if userID != 0 {
+		id = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	r, err := db.Exec(stmt, email, id, ip, result)
+	if err != nil {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
+
+// Changes the result recorded for the login attempt with the given ID
+func setLoginResult(db *sql.DB, attempt int64, result string) error {
+	_, err := db.Exec(`UPDATE login_attempts SET result = ? WHERE id = ?`, result, attempt)
+	return err
+}
+
+// LoginAttemptModel looks after the login_attempts table, which Authenticate records every login
+// in. This only clears out the old ones.
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// DeleteExpired deletes up to limit login attempts made before the given time, returning how many
+// it deleted
+func (m *LoginAttemptModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	stmt := `DELETE FROM login_attempts WHERE created < ? LIMIT ?`
+
+	result, err := m.DB.Exec(stmt, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
@@ -0,0 +1,22 @@
+package mocks
+
+import (
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+// Issued by Insert, and the only token Check and UserModel.ResetPassword accept, for the user with
+// ID 1
+const ValidResetToken = "validresettoken"
+
+type PasswordResetModel struct{}
+
+func (m *PasswordResetModel) Insert(userID int) (string, error) {
+	return ValidResetToken, nil
+}
+
+func (m *PasswordResetModel) Check(plaintext string) error {
+	if plaintext == ValidResetToken {
+		return nil
+	}
+	return models.ErrInvalidCredentials
+}
@@ -0,0 +1,61 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+var MockRevisions = []*models.Revision{
+	{
+		ID:        2,
+		SnippetID: 1,
+		UserID:    1,
+		Author:    ValidName,
+		Title:     "An old silent pond",
+		Content:   "An old silent pond...",
+		Created:   time.Now(),
+	},
+	{
+		ID:        1,
+		SnippetID: 1,
+		UserID:    1,
+		Author:    ValidName,
+		Title:     "An old silent pond",
+		Content:   "An old pond...",
+		Created:   time.Now(),
+	},
+}
+
+type RevisionModel struct{}
+
+func (m *RevisionModel) Insert(snippetID, userID int, title, content string) (int, error) {
+	return 3, nil
+}
+
+func (m *RevisionModel) Get(snippetID, id int) (*models.Revision, error) {
+	for _, r := range MockRevisions {
+		if r.SnippetID == snippetID && r.ID == id {
+			return r, nil
+		}
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+func (m *RevisionModel) List(snippetID int) ([]*models.Revision, error) {
+	revisions := []*models.Revision{}
+
+	for _, r := range MockRevisions {
+		if r.SnippetID == snippetID {
+			revisions = append(revisions, r)
+		}
+	}
+
+	return revisions, nil
+}
+
+func (m *RevisionModel) Restore(snippetID, id, userID int) error {
+	_, err := m.Get(snippetID, id)
+	return err
+}
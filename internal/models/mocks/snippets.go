@@ -1,34 +1,246 @@
 package mocks
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mhrdini/snippetbox/internal/models"
 )
 
 var MockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	Slug:       "P0nd5ilent",
+	UserID:     1,
+	Author:     ValidName,
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Language:   "text",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now(),
 }
 
+// MockOtherSnippet belongs to a different user than the one mocks.UserModel authenticates, for
+// testing owner-only actions
+var MockOtherSnippet = &models.Snippet{
+	ID:         3,
+	Slug:       "W1ntryF0rs",
+	UserID:     2,
+	Author:     "Shadowheart",
+	Title:      "Over the wintry forest",
+	Content:    "Over the wintry forest...",
+	Language:   "text",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now(),
+}
+
+// MockPrivateSnippet belongs to the user mocks.UserModel authenticates, and only they may see it
+var MockPrivateSnippet = &models.Snippet{
+	ID:         4,
+	Slug:       "Aut0mnM0rn",
+	UserID:     1,
+	Author:     ValidName,
+	Title:      "First autumn morning",
+	Content:    "First autumn morning...",
+	Language:   "text",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now(),
+}
+
+// MockBurnSnippet burns after reading and hasn't been read yet
+var MockBurnSnippet = &models.Snippet{
+	ID:               5,
+	Slug:             "Burn5ecret",
+	UserID:           1,
+	Author:           ValidName,
+	Title:            "Staging password",
+	Content:          "correct horse battery staple",
+	Language:         "text",
+	Visibility:       models.VisibilityUnlisted,
+	Created:          time.Now(),
+	Updated:          time.Now(),
+	Expires:          time.Now(),
+	BurnAfterReading: true,
+}
+
+// MockBurnedSnippet burned after someone read it
+var MockBurnedSnippet = &models.Snippet{
+	ID:               6,
+	Slug:             "BurnedD0ne",
+	UserID:           2,
+	Author:           "Shadowheart",
+	Title:            "Vault code",
+	Language:         "text",
+	Visibility:       models.VisibilityUnlisted,
+	Created:          time.Now(),
+	Updated:          time.Now(),
+	Expires:          time.Now(),
+	BurnAfterReading: true,
+	Burned:           true,
+}
+
+// MockProtectedSnippet needs MockPassphrase to be read by anyone but its owner
+var MockProtectedSnippet = &models.Snippet{
+	ID:         7,
+	Slug:       "L0ckedD00r",
+	UserID:     2,
+	Author:     "Shadowheart",
+	Title:      "The night is dark",
+	Content:    "The night is dark and full of secrets...",
+	Language:   "text",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now(),
+	Protected:  true,
+}
+
+const (
+	MockPassphrase = "open sesame"
+	// Unlock always answers this passphrase with models.ErrTooManyAttempts
+	MockThrottledPassphrase = "too many guesses"
+)
+
+var mockSnippets = []*models.Snippet{MockSnippet, MockOtherSnippet, MockPrivateSnippet, MockBurnSnippet, MockBurnedSnippet, MockProtectedSnippet}
+
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
-	return 2, nil
+// Save pretends a new snippet is MockSnippet, so handlers that read back what they created get a
+// record from Get, and updates the snippets Get knows about
+func (m *SnippetModel) Save(s *models.Snippet, editorID int, tags []string) error {
+	if s.ID == 0 {
+		s.ID = MockSnippet.ID
+		s.Slug = MockSnippet.Slug
+		return nil
+	}
+
+	switch s.ID {
+	case 1, 3, 4, 5, 7:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
 }
 
 func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return MockSnippet, nil
+	case 3:
+		return MockOtherSnippet, nil
+	case 4:
+		return MockPrivateSnippet, nil
+	case 5:
+		return MockBurnSnippet, nil
+	case 6:
+		return MockBurnedSnippet, nil
+	case 7:
+		return MockProtectedSnippet, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	for _, s := range mockSnippets {
+		if s.Slug == slug {
+			return s, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	return []*models.Snippet{MockSnippet}, nil
 }
+
+func (m *SnippetModel) Consume(id int) (*models.Snippet, error) {
+	switch id {
+	case 5:
+		return MockBurnSnippet, nil
+	case 6:
+		return nil, models.ErrGone
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Unlock(id int, passphrase string) error {
+	if id != MockProtectedSnippet.ID {
+		return models.ErrNoRecord
+	}
+
+	switch passphrase {
+	case MockPassphrase:
+		return nil
+	case MockThrottledPassphrase:
+		return models.ErrTooManyAttempts
+	default:
+		return models.ErrInvalidCredentials
+	}
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	switch id {
+	case 1, 3, 4, 5, 6, 7:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+// List pages through the snippets in mockSnippets order. Its cursors are just the offset of the
+// page's first snippet, anything else is models.ErrInvalidCursor.
+func (m *SnippetModel) List(opts models.ListOptions) (*models.SnippetPage, error) {
+	snippets := []*models.Snippet{}
+	for _, s := range mockSnippets {
+		if s.Visibility != models.VisibilityPublic && s.UserID != opts.ViewerID {
+			continue
+		}
+		if opts.AuthorID == 0 || opts.AuthorID == s.UserID {
+			snippets = append(snippets, s)
+		}
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = models.DefaultPageSize
+	}
+
+	offset := 0
+	if opts.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(opts.Cursor)
+		if err != nil || offset < 0 || offset > len(snippets) {
+			return nil, models.ErrInvalidCursor
+		}
+	}
+
+	page := &models.SnippetPage{Snippets: snippets[offset:min(offset+limit, len(snippets))]}
+	if offset+limit < len(snippets) {
+		page.Next = strconv.Itoa(offset + limit)
+	}
+	if offset > 0 {
+		page.Prev = strconv.Itoa(max(offset-limit, 0))
+	}
+
+	return page, nil
+}
+
+func (m *SnippetModel) Search(query string, limit int, cursor string) (*models.SnippetPage, error) {
+	page := &models.SnippetPage{Snippets: []*models.Snippet{}}
+
+	for _, s := range []*models.Snippet{MockSnippet, MockOtherSnippet} {
+		if strings.Contains(strings.ToLower(s.Title+" "+s.Content), strings.ToLower(query)) {
+			page.Snippets = append(page.Snippets, s)
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,35 @@
+package mocks
+
+import "github.com/mhrdini/snippetbox/internal/models"
+
+var MockTags = []string{"haiku", "poetry"}
+
+type TagModel struct{}
+
+func (m *TagModel) Set(snippetID int, tags []string) error {
+	return nil
+}
+
+func (m *TagModel) ForSnippet(snippetID int) ([]string, error) {
+	if snippetID == MockSnippet.ID {
+		return MockTags, nil
+	}
+	return []string{}, nil
+}
+
+func (m *TagModel) Snippets(tag string, limit int) ([]*models.Snippet, error) {
+	for _, t := range MockTags {
+		if t == tag {
+			return []*models.Snippet{MockSnippet}, nil
+		}
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *TagModel) Cloud(limit int) ([]*models.TagCount, error) {
+	cloud := []*models.TagCount{}
+	for _, t := range MockTags {
+		cloud = append(cloud, &models.TagCount{Name: t, Count: 1})
+	}
+	return cloud, nil
+}
@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/models"
+)
+
+const (
+	ValidReadToken  = "sbx_readonlytoken"
+	ValidWriteToken = "sbx_readwritetoken"
+)
+
+var MockToken = &models.Token{
+	ID:      1,
+	UserID:  1,
+	Name:    "Deploy script",
+	Scopes:  []string{models.ScopeRead, models.ScopeWrite},
+	Created: time.Now(),
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(userID int, name string, scopes []string) (*models.Token, error) {
+	return &models.Token{
+		ID:        2,
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		Created:   time.Now(),
+		Plaintext: ValidWriteToken,
+	}, nil
+}
+
+func (m *TokenModel) List(userID int) ([]*models.Token, error) {
+	if userID == MockToken.UserID {
+		return []*models.Token{MockToken}, nil
+	}
+	return []*models.Token{}, nil
+}
+
+func (m *TokenModel) Revoke(userID, id int) error {
+	if userID == MockToken.UserID && id == MockToken.ID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *TokenModel) Authenticate(plaintext string) (*models.Token, error) {
+	switch plaintext {
+	case ValidReadToken:
+		return &models.Token{ID: 3, UserID: 1, Name: "Read only", Scopes: []string{models.ScopeRead}}, nil
+	case ValidWriteToken:
+		return MockToken, nil
+	default:
+		return nil, models.ErrInvalidCredentials
+	}
+}
@@ -1,12 +1,18 @@
 package mocks
 
-import "github.com/mhrdini/snippetbox/internal/models"
+import (
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/models"
+)
 
 const (
 	ValidName     = "Astarion Ancunin"
 	ValidEmail    = "lilstar@bg3.com"
 	ValidPassword = "cazadorsucks"
 	DupeEmail     = "dupe@email.com"
+	// Authenticate always answers this email with a *models.LockoutError
+	LockedEmail = "locked@email.com"
 )
 
 type UserModel struct{}
@@ -20,7 +26,11 @@ func (m *UserModel) Insert(name, email, password string) error {
 	}
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(email, password, ip string) (int, error) {
+	if email == LockedEmail {
+		return 0, &models.LockoutError{Until: time.Now().Add(10 * time.Minute)}
+	}
+
 	if email == ValidEmail && password == ValidPassword {
 		return 1, nil
 	}
@@ -36,3 +46,31 @@ func (m *UserModel) Exists(id int) (bool, error) {
 		return false, models.ErrNoRecord
 	}
 }
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	if email == ValidEmail {
+		return &models.User{ID: 1, Name: ValidName, Email: ValidEmail}, nil
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *UserModel) SessionVersion(id int) (int, error) {
+	if id == 1 {
+		return 0, nil
+	}
+	return 0, models.ErrNoRecord
+}
+
+func (m *UserModel) UpdatePassword(id int, password, ip string) error {
+	if id == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *UserModel) ResetPassword(token, password, ip string) (int, error) {
+	if token == ValidResetToken {
+		return 1, nil
+	}
+	return 0, models.ErrInvalidCredentials
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"time"
+)
+
+// How long a password reset link works for after it's sent
+const PasswordResetTTL = time.Hour
+
+type PasswordResetModelInterface interface {
+	Insert(userID int) (string, error)
+	Check(plaintext string) error
+}
+
+// PasswordResetModel looks after the tokens emailed to users who've forgotten their password.
+// Like personal access tokens, only a SHA-256 hash of each token is stored. Tokens expire after
+// PasswordResetTTL, and are used up by UserModel.ResetPassword.
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+// Insert generates a new reset token for the user, returning its plaintext
+func (m *PasswordResetModel) Insert(userID int) (string, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(plaintext))
+
+	stmt := `INSERT INTO password_resets (user_id, hash, created, expires)
+	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stmt, userID, hash[:], int(PasswordResetTTL.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Check returns ErrInvalidCredentials unless the token exists and hasn't expired, without using
+// it up
+func (m *PasswordResetModel) Check(plaintext string) error {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	stmt := `SELECT EXISTS(SELECT true FROM password_resets WHERE hash = ? AND expires > UTC_TIMESTAMP())`
+
+	var exists bool
+	err := m.DB.QueryRow(stmt, hash[:]).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes up to limit reset tokens that expired before the given time, returning
+// how many it deleted
+func (m *PasswordResetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	stmt := `DELETE FROM password_resets WHERE expires < ? LIMIT ?`
+
+	result, err := m.DB.Exec(stmt, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestPasswordResetModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := PasswordResetModel{db}
+
+	first, err := m.Insert(1)
+	assert.NilError(t, err)
+	second, err := m.Insert(1)
+	assert.NilError(t, err)
+
+	// Only the hash is stored
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM password_resets WHERE hash = ?`, first).Scan(&n)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+
+	assert.NilError(t, m.Check(first))
+	assert.Equal(t, m.Check("not a token"), ErrInvalidCredentials)
+
+	assert.NilError(t, m.Check(second))
+
+	// Expired tokens don't work
+	expired, err := m.Insert(1)
+	assert.NilError(t, err)
+	_, err = db.Exec(`UPDATE password_resets SET expires = DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 MINUTE)`)
+	assert.NilError(t, err)
+	assert.Equal(t, m.Check(expired), ErrInvalidCredentials)
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Revision is a saved version of a snippet's title and content. A new revision is recorded every
+// time a snippet is created, edited or restored, so the latest revision matches the snippet.
+type Revision struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	Author    string
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+type RevisionModelInterface interface {
+	Insert(snippetID, userID int, title, content string) (int, error)
+	Get(snippetID, id int) (*Revision, error)
+	List(snippetID int) ([]*Revision, error)
+	Restore(snippetID, id, userID int) error
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+func (m *RevisionModel) Insert(snippetID, userID int, title, content string) (int, error) {
+	return insertRevision(m.DB, snippetID, userID, title, content)
+}
+
+func insertRevision(db execer, snippetID, userID int, title, content string) (int, error) {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := db.Exec(stmt, snippetID, userID, title, content)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns a revision, scoped to its snippet so a revision ID from another snippet can't be
+// looked up through the wrong URL
+func (m *RevisionModel) Get(snippetID, id int) (*Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.user_id, u.name, r.title, r.content, r.created
+	FROM snippet_revisions r
+	INNER JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? AND r.id = ?`
+
+	r := &Revision{}
+
+	err := m.DB.QueryRow(stmt, snippetID, id).Scan(&r.ID, &r.SnippetID, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// List returns every revision of a snippet, newest first
+func (m *RevisionModel) List(snippetID int) ([]*Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.user_id, u.name, r.title, r.content, r.created
+	FROM snippet_revisions r
+	INNER JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? ORDER BY r.id DESC`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		r := &Revision{}
+		err := rows.Scan(&r.ID, &r.SnippetID, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Restore makes an old revision the snippet's current title and content, recording it as a new
+// revision by userID. Both writes happen in one transaction so the history never disagrees with
+// the snippet.
+func (m *RevisionModel) Restore(snippetID, id, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	var title, content string
+
+	stmt := `SELECT title, content FROM snippet_revisions WHERE snippet_id = ? AND id = ?`
+
+	err = tx.QueryRow(stmt, snippetID, id).Scan(&title, &content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	stmt = `UPDATE snippets SET title = ?, content = ?, updated = UTC_TIMESTAMP() WHERE id = ?`
+
+	_, err = tx.Exec(stmt, title, content, snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = insertRevision(tx, snippetID, userID, title, content)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
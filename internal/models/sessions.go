@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SessionModel looks after the sessions table that scs keeps its sessions in. scs reads and writes
+// the sessions itself, this only clears out the expired ones.
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// DeleteExpired deletes up to limit sessions that expired before the given time, returning how
+// many it deleted
+func (m *SessionModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	stmt := `DELETE FROM sessions WHERE expiry < ? LIMIT ?`
+
+	result, err := m.DB.Exec(stmt, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestSessionModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	now := time.Now().UTC()
+
+	stmt := `INSERT INTO sessions (token, data, expiry) VALUES (?, '', ?)`
+	for token, expiry := range map[string]time.Time{
+		"expired": now.Add(-time.Minute),
+		"current": now.Add(time.Hour),
+	} {
+		_, err := db.Exec(stmt, token, expiry)
+		assert.NilError(t, err)
+	}
+
+	m := SessionModel{db}
+
+	n, err := m.DeleteExpired(now, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	var left string
+	err = db.QueryRow(`SELECT token FROM sessions`).Scan(&left)
+	assert.NilError(t, err)
+	assert.Equal(t, left, "current")
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// SlugLength is the length of a snippet's slug. 62^10 possible slugs keep them unguessable, and
+// collisions rare enough that Insert retrying a couple of times is plenty.
+const SlugLength = 10
+
+const slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// How many times Insert tries a new slug after a collision before giving up
+const maxSlugAttempts = 3
+
+// Returns a random base62 slug from crypto/rand
+func newSlug() (string, error) {
+	slug := make([]byte, 0, SlugLength)
+	buf := make([]byte, SlugLength*2)
+
+	for len(slug) < SlugLength {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			// Drop bytes past the largest multiple of 62 so every character is equally likely
+			if b >= 248 {
+				continue
+			}
+			slug = append(slug, slugAlphabet[b%62])
+			if len(slug) == SlugLength {
+				break
+			}
+		}
+	}
+
+	return string(slug), nil
+}
+
+// ValidSlug reports whether s could be a slug, so malformed ones can be turned away without a
+// query
+func ValidSlug(s string) bool {
+	if len(s) != SlugLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(slugAlphabet, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
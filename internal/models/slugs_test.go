@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestNewSlug(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 1000; i++ {
+		slug, err := newSlug()
+		assert.NilError(t, err)
+		assert.Equal(t, ValidSlug(slug), true)
+
+		if seen[slug] {
+			t.Fatalf("duplicate slug %q", slug)
+		}
+		seen[slug] = true
+	}
+}
+
+func TestValidSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		slug string
+		want bool
+	}{
+		{name: "Valid", slug: "aZ09bY18cX", want: true},
+		{name: "Too short", slug: "aZ09bY18c", want: false},
+		{name: "Too long", slug: "aZ09bY18cXw", want: false},
+		{name: "Not base62", slug: "aZ09bY18c-", want: false},
+		{name: "Empty", slug: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, ValidSlug(tt.slug), tt.want)
+		})
+	}
+}
@@ -2,53 +2,281 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Orderings accepted by ListOptions.Sort
+const (
+	SortNewest   = "newest"
+	SortOldest   = "oldest"
+	SortExpiring = "expiring"
+)
+
+// Page size bounds for List, a zero ListOptions.Limit uses DefaultPageSize
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Who can see a snippet. Only public snippets are listed and searchable, unlisted ones can be
+// viewed by anyone with the link and private ones only by their owner.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Throttling of wrong passphrases by Unlock. Callers are expected to limit each client's guesses
+// themselves, so this only has to stop guesses spread across many clients, and is set high enough
+// that no one client can lock a snippet for its readers.
+const (
+	maxPassphraseFailures = 100
+	minPassphraseLockout  = time.Minute
+	maxPassphraseLockout  = time.Hour
 )
 
+// Returns how long a snippet stays locked after the given number of wrong passphrases in a row,
+// doubling with each one past maxPassphraseFailures
+func passphraseLockout(failures int) time.Duration {
+	return backoff(failures, maxPassphraseFailures, minPassphraseLockout, maxPassphraseLockout)
+}
+
+// Returns how long to lock something after the given number of failures in a row: shortest once
+// there have been threshold of them, then doubling with each further one up to longest
+func backoff(failures, threshold int, shortest, longest time.Duration) time.Duration {
+	lockout := shortest
+	for i := threshold; i < failures && lockout < longest; i++ {
+		lockout *= 2
+	}
+	if lockout > longest {
+		lockout = longest
+	}
+	return lockout
+}
+
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	Slug       string // random and unguessable, used in URLs instead of ID
+	UserID     int
+	Author     string
+	Title      string
+	Content    string
+	Language   string // one of highlight.Languages, used to pick a syntax highlighter
+	Visibility string // one of VisibilityPublic, VisibilityUnlisted or VisibilityPrivate
+	Created    time.Time
+	Updated    time.Time
+	Expires    time.Time // zero if the snippet never expires
+	// KeepExpires has Update and Save leave an existing snippet's expiry as it is, ignoring Expires
+	KeepExpires bool
+	// BurnAfterReading snippets can only be read once, by Consume, after which they're Burned
+	BurnAfterReading bool
+	Burned           bool
+	// Protected snippets need a passphrase to be read, checked by Unlock. Passphrase is only used
+	// by Insert, it's stored as a bcrypt hash and never read back.
+	Protected  bool
+	Passphrase string
+}
+
+// Columns selected for a Snippet, in the order scanSnippet reads them. Queries must alias
+// snippets as s and join users as u for the author's name.
+const snippetColumns = `s.id, s.slug, s.user_id, u.name, s.title, s.content, s.language, s.visibility, s.created, s.updated, s.expires, s.burn_after_reading, s.burned IS NOT NULL, s.passphrase_hash IS NOT NULL`
+
+// Converts an expiry time to a column value, NULL for the zero time
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Scans a row selected with snippetColumns, followed by any extra columns into extra
+func scanSnippet(row scanner, extra ...any) (*Snippet, error) {
+	s := &Snippet{}
+	var expires sql.NullTime
+
+	dest := []any{&s.ID, &s.Slug, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Created, &s.Updated, &expires, &s.BurnAfterReading, &s.Burned, &s.Protected}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	s.Expires = expires.Time
+
+	return s, nil
+}
+
+// VisibleTo reports whether the user with the given ID, or 0 for anonymous users, may view s
+func (s *Snippet) VisibleTo(userID int) bool {
+	return s.Visibility != VisibilityPrivate || s.UserID == userID
+}
+
+type ListOptions struct {
+	Sort     string // one of SortNewest (the default), SortOldest or SortExpiring, which leaves out snippets that never expire
+	AuthorID int    // only list snippets by this user if non-zero
+	ViewerID int    // the user listing, whose own unlisted and private snippets are included
+	Limit    int
+	Cursor   string // Next or Prev from a previous SnippetPage, empty for the first page
+}
+
+// SnippetPage is one page of a List result. Next and Prev are opaque cursors for the adjacent
+// pages, and are empty when there is no page in that direction.
+type SnippetPage struct {
+	Snippets []*Snippet
+	Next     string
+	Prev     string
 }
 
 type SnippetModelInterface interface {
-	Insert(title, content string, expires int) (int, error)
+	Save(s *Snippet, editorID int, tags []string) error
 	Get(id int) (*Snippet, error)
+	GetBySlug(slug string) (*Snippet, error)
 	Latest() ([]*Snippet, error)
+	List(opts ListOptions) (*SnippetPage, error)
+	Search(query string, limit int, cursor string) (*SnippetPage, error)
+	Consume(id int) (*Snippet, error)
+	Unlock(id int, passphrase string) error
+	Delete(id int) error
 }
 
 type SnippetModel struct {
-	DB *sql.DB
+	DB         *sql.DB
+	BcryptCost int // cost of hashing passphrases, bcrypt.DefaultCost if below bcrypt.MinCost
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so a write can be made on its own or as part
+// of a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Insert adds a snippet owned by s.UserID with the title, content, language, visibility, expiry,
+// burn after reading setting and passphrase, if any, of s. It sets s.ID and s.Slug to those of
+// the new snippet, and s.Protected.
+func (m *SnippetModel) Insert(s *Snippet) error {
+	passphraseHash, err := m.hashPassphrase(s.Passphrase)
+	if err != nil {
+		return err
+	}
+	return insertSnippet(m.DB, s, passphraseHash)
 }
 
-func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires) 
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// Save writes s along with a revision of its title and content by editorID and its tags, all in
+// one transaction so the snippet never disagrees with its history or tags. A snippet with a zero
+// ID is inserted, as by Insert, otherwise it's updated, as by Update.
+func (m *SnippetModel) Save(s *Snippet, editorID int, tags []string) error {
+	var passphraseHash sql.NullString
+	if s.ID == 0 {
+		// Hashed before the transaction starts, so it isn't held open for as long as bcrypt takes
+		var err error
+		passphraseHash, err = m.hashPassphrase(s.Passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	if s.ID == 0 {
+		err = insertSnippet(tx, s, passphraseHash)
+	} else {
+		err = updateSnippet(tx, s)
+	}
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	id, err := result.LastInsertId()
+	_, err = insertRevision(tx, s.ID, editorID, s.Title, s.Content)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return int(id), nil
+	err = setTags(tx, s.ID, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Hashes a snippet's passphrase, if it has one
+func (m *SnippetModel) hashPassphrase(passphrase string) (sql.NullString, error) {
+	if passphrase == "" {
+		return sql.NullString{}, nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(passphrase), m.BcryptCost)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(hash), Valid: true}, nil
+}
+
+func insertSnippet(db execer, s *Snippet, passphraseHash sql.NullString) error {
+	stmt := `INSERT INTO snippets (slug, user_id, title, content, language, visibility, burn_after_reading, passphrase_hash, created, updated, expires) 
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?)`
+
+	for attempt := 1; ; attempt++ {
+		slug, err := newSlug()
+		if err != nil {
+			return err
+		}
+
+		// A duplicate key only fails the statement, not the transaction it's in, so retrying is safe
+		result, err := db.Exec(stmt, slug, s.UserID, s.Title, s.Content, s.Language, s.Visibility, s.BurnAfterReading, passphraseHash, nullTime(s.Expires))
+		if err != nil {
+			// Try again with another slug if this one is already taken
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) && attempt < maxSlugAttempts {
+				if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "snippets_uc_slug") {
+					continue
+				}
+			}
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		s.ID = int(id)
+		s.Slug = slug
+		s.Protected = passphraseHash.Valid
+		return nil
+	}
 }
 
+// Get returns an unexpired snippet whatever its visibility, callers must check Snippet.VisibleTo
+// before showing it
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets s
+	INNER JOIN users u ON u.id = s.user_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.id = ?`
 
 	row := m.DB.QueryRow(stmt, id)
 
-	s := &Snippet{}
+	s, err := scanSnippet(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetBySlug is like Get but looks the snippet up by its slug
+func (m *SnippetModel) GetBySlug(slug string) (*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets s
+	INNER JOIN users u ON u.id = s.user_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.slug = ?`
 
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	s, err := scanSnippet(m.DB.QueryRow(stmt, slug))
 	if err == sql.ErrNoRows {
 		return nil, ErrNoRecord
 	} else if err != nil {
@@ -58,8 +286,9 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 }
 
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY created DESC LIMIT 10`
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets s
+	INNER JOIN users u ON u.id = s.user_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.visibility = 'public' ORDER BY s.created DESC LIMIT 10`
 
 	rows, err := m.DB.Query(stmt)
 	if err != nil {
@@ -77,8 +306,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// resultset. Once this finishes, resultset automatically closes itself and frees up the
 	// underlying database connection
 	for rows.Next() {
-		s := &Snippet{}
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -92,3 +320,380 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 	return snippets, nil
 }
+
+// List returns a page of unexpired public snippets, plus the viewer's own, using keyset pagination, i.e. each page continues from
+// the sort key and ID of the last row of the previous one rather than an OFFSET, so pages stay
+// stable and cheap however deep you go
+func (m *SnippetModel) List(opts ListOptions) (*SnippetPage, error) {
+	// Pick the sort key column and whether the listing runs in ascending order
+	var column string
+	var ascending bool
+	switch opts.Sort {
+	case SortNewest, "":
+		column, ascending = "s.created", false
+	case SortOldest:
+		column, ascending = "s.created", true
+	case SortExpiring:
+		column, ascending = "s.expires", true
+	default:
+		return nil, fmt.Errorf("models: unknown sort %q", opts.Sort)
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	var c cursor
+	if opts.Cursor != "" {
+		var err error
+		c, err = decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Going backwards means reading the rows before the cursor in reverse, then flipping them
+	// back into listing order
+	if c.Backward {
+		ascending = !ascending
+	}
+
+	cmp, order := "<", "DESC"
+	if ascending {
+		cmp, order = ">", "ASC"
+	}
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets s
+	INNER JOIN users u ON u.id = s.user_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND (s.visibility = 'public' OR s.user_id = ?)`
+	args := []any{opts.ViewerID}
+
+	// Snippets that never expire have no place in a listing by expiry
+	if opts.Sort == SortExpiring {
+		stmt += ` AND s.expires IS NOT NULL`
+	}
+
+	if opts.AuthorID != 0 {
+		stmt += ` AND s.user_id = ?`
+		args = append(args, opts.AuthorID)
+	}
+
+	if opts.Cursor != "" {
+		stmt += fmt.Sprintf(` AND (%[1]s %[2]s ? OR (%[1]s = ? AND s.id %[2]s ?))`, column, cmp)
+		args = append(args, c.Key, c.Key, c.ID)
+	}
+
+	// Fetch one extra row to find out if there's another page in the direction we're going
+	stmt += fmt.Sprintf(` ORDER BY %[1]s %[2]s, s.id %[2]s LIMIT ?`, column, order)
+	args = append(args, limit+1)
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	more := len(snippets) > limit
+	if more {
+		snippets = snippets[:limit]
+	}
+
+	if c.Backward {
+		for i, j := 0, len(snippets)-1; i < j; i, j = i+1, j-1 {
+			snippets[i], snippets[j] = snippets[j], snippets[i]
+		}
+	}
+
+	page := &SnippetPage{Snippets: snippets}
+	if len(snippets) == 0 {
+		return page, nil
+	}
+
+	key := func(s *Snippet) time.Time {
+		if opts.Sort == SortExpiring {
+			return s.Expires
+		}
+		return s.Created
+	}
+	first, last := snippets[0], snippets[len(snippets)-1]
+
+	// There's always a page back the way we came from, and one further on if we found an extra row
+	if more || c.Backward {
+		page.Next = cursor{Key: key(last), ID: last.ID}.encode()
+	}
+	if (c.Backward && more) || (!c.Backward && opts.Cursor != "") {
+		page.Prev = cursor{Backward: true, Key: key(first), ID: first.ID}.encode()
+	}
+
+	return page, nil
+}
+
+// Search returns a page of unexpired public snippets matching query in their title or content, most
+// relevant first, using the FULLTEXT index in natural language mode. Protected snippets are left
+// out, since matching their content would give it away.
+func (m *SnippetModel) Search(query string, limit int, cursor string) (*SnippetPage, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	offset := 0
+	if cursor != "" {
+		var err error
+		offset, err = decodeOffset(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stmt := `SELECT ` + snippetColumns + `,
+	MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) AS score
+	FROM snippets s
+	INNER JOIN users u ON u.id = s.user_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.visibility = 'public' AND s.passphrase_hash IS NULL
+	AND MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE)
+	ORDER BY score DESC, s.id DESC LIMIT ? OFFSET ?`
+
+	// Fetch one extra row to find out if there's a next page
+	rows, err := m.DB.Query(stmt, query, query, limit+1, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		var score float64
+		s, err := scanSnippet(rows, &score)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &SnippetPage{Snippets: snippets}
+
+	if len(snippets) > limit {
+		page.Snippets = snippets[:limit]
+		page.Next = encodeOffset(offset + limit)
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.Prev = encodeOffset(prev)
+	}
+
+	return page, nil
+}
+
+// Update replaces the title, content, language, visibility and, unless s.KeepExpires is set,
+// expiry of the snippet with ID s.ID
+func (m *SnippetModel) Update(s *Snippet) error {
+	return updateSnippet(m.DB, s)
+}
+
+func updateSnippet(db execer, s *Snippet) error {
+	stmt := `UPDATE snippets SET title = ?, content = ?, language = ?, visibility = ?, updated = UTC_TIMESTAMP(),
+	expires = IF(?, expires, ?)
+	WHERE id = ?`
+
+	_, err := db.Exec(stmt, s.Title, s.Content, s.Language, s.Visibility, s.KeepExpires, nullTime(s.Expires), s.ID)
+	return err
+}
+
+// Consume reads a burn after reading snippet for the one and only time. The snippet is returned
+// as it was, but its content and revisions are wiped and it's flagged as burned in the same
+// transaction. The row stays locked until then, so of two concurrent readers only one gets the
+// content and the other gets ErrGone, as does everyone after them.
+func (m *SnippetModel) Consume(id int) (*Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets s
+	INNER JOIN users u ON u.id = s.user_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.id = ?
+	FOR UPDATE`
+
+	s, err := scanSnippet(tx.QueryRow(stmt, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	if s.Burned {
+		return nil, ErrGone
+	}
+	if !s.BurnAfterReading {
+		return nil, fmt.Errorf("models: snippet %d is not burn after reading", id)
+	}
+
+	stmt = `UPDATE snippets SET content = '', burned = UTC_TIMESTAMP() WHERE id = ?`
+
+	_, err = tx.Exec(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Old revisions hold copies of the content too
+	stmt = `DELETE FROM snippet_revisions WHERE snippet_id = ?`
+
+	_, err = tx.Exec(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Unlock checks passphrase against a protected snippet's, returning ErrInvalidCredentials if it
+// doesn't match. After maxPassphraseFailures wrong guesses in a row, each further one locks the
+// snippet for twice as long as the last, up to maxPassphraseLockout, and Unlock returns
+// ErrTooManyAttempts without checking the passphrase until the lock runs out.
+func (m *SnippetModel) Unlock(id int, passphrase string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	var hash sql.NullString
+	var failures int
+	var locked bool
+
+	// Lock the row so concurrent guesses are counted one after the other
+	stmt := `SELECT passphrase_hash, passphrase_failures, IFNULL(passphrase_retry > UTC_TIMESTAMP(), FALSE)
+	FROM snippets WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND id = ?
+	FOR UPDATE`
+
+	err = tx.QueryRow(stmt, id).Scan(&hash, &failures, &locked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if !hash.Valid {
+		return fmt.Errorf("models: snippet %d is not protected", id)
+	}
+	if locked {
+		return ErrTooManyAttempts
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(passphrase))
+	if err == nil {
+		stmt = `UPDATE snippets SET passphrase_failures = 0, passphrase_retry = NULL WHERE id = ?`
+		_, err = tx.Exec(stmt, id)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	} else if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return err
+	}
+
+	failures++
+	stmt = `UPDATE snippets SET passphrase_failures = ?, passphrase_retry = NULL WHERE id = ?`
+	args := []any{failures, id}
+	if failures >= maxPassphraseFailures {
+		stmt = `UPDATE snippets SET passphrase_failures = ?,
+		passphrase_retry = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND) WHERE id = ?`
+		args = []any{failures, int(passphraseLockout(failures).Seconds()), id}
+	}
+
+	_, err = tx.Exec(stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return ErrInvalidCredentials
+}
+
+// DeleteExpired deletes up to limit snippets that expired, or were burned after reading, before
+// the given time, along with their revisions and tags. Returns how many it deleted.
+func (m *SnippetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	// Two statements rather than an OR, so each can use its column's index
+	deleted := 0
+	for _, stmt := range []string{
+		`DELETE FROM snippets WHERE expires < ? LIMIT ?`,
+		`DELETE FROM snippets WHERE burned < ? LIMIT ?`,
+	} {
+		result, err := m.DB.Exec(stmt, before, limit-deleted)
+		if err != nil {
+			return deleted, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += int(rows)
+		if deleted >= limit {
+			break
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	stmt := `DELETE FROM snippets WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,425 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSnippetModelInsertRecordsAuthor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	m := SnippetModel{DB: db}
+
+	inserted := &Snippet{
+		UserID:     1,
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Language:   "text",
+		Visibility: VisibilityPublic,
+	}
+	err := m.Insert(inserted)
+	assert.NilError(t, err)
+
+	s, err := m.Get(inserted.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, s.UserID, 1)
+	assert.Equal(t, s.Author, "Astarion Ancunin")
+
+	s, err = m.GetBySlug(inserted.Slug)
+	assert.NilError(t, err)
+	assert.Equal(t, s.ID, inserted.ID)
+
+	// Slugs are case-sensitive
+	_, err = m.GetBySlug(strings.ToLower(inserted.Slug))
+	if inserted.Slug != strings.ToLower(inserted.Slug) {
+		assert.Equal(t, err, ErrNoRecord)
+	}
+}
+
+func TestSnippetModelSave(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	m := SnippetModel{DB: db}
+	revisions := RevisionModel{DB: db}
+	tags := TagModel{DB: db}
+
+	s := &Snippet{
+		UserID:     1,
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Language:   "text",
+		Visibility: VisibilityPublic,
+	}
+	err := m.Save(s, 1, []string{"haiku"})
+	assert.NilError(t, err)
+
+	history, err := revisions.List(s.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(history), 1)
+	assert.Equal(t, history[0].Title, "An old silent pond")
+
+	// Kept to the second, where the form's expires_at only goes down to the minute
+	expires := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	s.Expires = expires
+	err = m.Save(s, 1, []string{"haiku"})
+	assert.NilError(t, err)
+
+	s.Title = "A frog jumps into the pond"
+	s.Expires = time.Time{}
+	s.KeepExpires = true
+	err = m.Save(s, 1, []string{"haiku", "frogs"})
+	assert.NilError(t, err)
+
+	saved, err := m.Get(s.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, saved.Expires.Equal(expires), true)
+
+	history, err = revisions.List(s.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(history), 3)
+	assert.Equal(t, history[0].Title, "A frog jumps into the pond")
+
+	// A revision that can't be recorded, here by an editor who doesn't exist, undoes the update
+	// and leaves the tags as they were
+	s.Title = "Splash! Silence again"
+	err = m.Save(s, 999, []string{"splash"})
+	if err == nil {
+		t.Fatal("got: nil; expected an error")
+	}
+
+	saved, err = m.Get(s.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, saved.Title, "A frog jumps into the pond")
+
+	got, err := tags.ForSnippet(s.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Join(got, ","), "frogs,haiku")
+}
+
+func TestSnippetModelList(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	m := SnippetModel{DB: db}
+
+	var inserted []int
+	for i := 0; i < 5; i++ {
+		s := &Snippet{
+			UserID:     1,
+			Title:      fmt.Sprintf("Snippet %d", i),
+			Content:    "An old silent pond...",
+			Language:   "text",
+			Visibility: VisibilityPublic,
+		}
+		assert.NilError(t, m.Insert(s))
+		inserted = append(inserted, s.ID)
+	}
+
+	// All created in the same second, so only the ID tells them apart
+	_, err := db.Exec(`UPDATE snippets SET created = '2024-06-07 10:00:00'`)
+	assert.NilError(t, err)
+
+	ids := func(page *SnippetPage) []int {
+		var ids []int
+		for _, s := range page.Snippets {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		sort  string
+		pages [][]int
+	}{
+		{
+			sort:  SortNewest,
+			pages: [][]int{{inserted[4], inserted[3]}, {inserted[2], inserted[1]}, {inserted[0]}},
+		},
+		{
+			sort:  SortOldest,
+			pages: [][]int{{inserted[0], inserted[1]}, {inserted[2], inserted[3]}, {inserted[4]}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			opts := ListOptions{Sort: tt.sort, Limit: 2}
+
+			// Forwards, following each page's Next
+			var pages []*SnippetPage
+			for i, want := range tt.pages {
+				page, err := m.List(opts)
+				assert.NilError(t, err)
+				assert.Equal(t, fmt.Sprint(ids(page)), fmt.Sprint(want))
+				assert.Equal(t, page.Prev != "", i > 0)
+				assert.Equal(t, page.Next != "", i < len(tt.pages)-1)
+
+				pages = append(pages, page)
+				opts.Cursor = page.Next
+			}
+
+			// and back again, following each page's Prev
+			for i := len(pages) - 1; i > 0; i-- {
+				opts.Cursor = pages[i].Prev
+				page, err := m.List(opts)
+				assert.NilError(t, err)
+				assert.Equal(t, fmt.Sprint(ids(page)), fmt.Sprint(tt.pages[i-1]))
+				assert.Equal(t, page.Prev != "", i-1 > 0)
+				assert.Equal(t, page.Next != "", true)
+			}
+		})
+	}
+
+	_, err = m.List(ListOptions{Cursor: "not a cursor"})
+	assert.Equal(t, err, ErrInvalidCursor)
+}
+
+func TestSnippetModelListVisibility(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	m := SnippetModel{DB: db}
+
+	for _, visibility := range []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate} {
+		err := m.Insert(&Snippet{
+			UserID:     1,
+			Title:      visibility,
+			Content:    "An old silent pond...",
+			Language:   "text",
+			Visibility: visibility,
+		})
+		assert.NilError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		viewerID int
+		want     int
+	}{
+		{
+			name:     "Anonymous",
+			viewerID: 0,
+			want:     1,
+		},
+		{
+			name:     "Owner",
+			viewerID: 1,
+			want:     3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := m.List(ListOptions{Sort: SortNewest, ViewerID: tt.viewerID})
+			assert.NilError(t, err)
+			assert.Equal(t, len(page.Snippets), tt.want)
+		})
+	}
+
+	latest, err := m.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(latest), 1)
+	assert.Equal(t, latest[0].Visibility, VisibilityPublic)
+}
+
+func TestSnippetModelConsume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	m := SnippetModel{DB: db}
+
+	inserted := &Snippet{
+		UserID:           1,
+		Title:            "Deploy key",
+		Content:          "hunter2",
+		Language:         "text",
+		Visibility:       VisibilityUnlisted,
+		BurnAfterReading: true,
+	}
+	err := m.Insert(inserted)
+	assert.NilError(t, err)
+
+	s, err := m.Consume(inserted.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Content, "hunter2")
+
+	// The snippet is still there to say it's gone, but its content isn't
+	s, err = m.Get(inserted.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Burned, true)
+	assert.Equal(t, s.Content, "")
+
+	_, err = m.Consume(inserted.ID)
+	assert.Equal(t, err, ErrGone)
+}
+
+func TestSnippetModelUnlock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	// A cheap hash, since the passphrase is checked once for each of many failures
+	m := SnippetModel{DB: db, BcryptCost: bcrypt.MinCost}
+
+	inserted := &Snippet{
+		UserID:     1,
+		Title:      "Deploy key",
+		Content:    "hunter2",
+		Language:   "text",
+		Visibility: VisibilityPublic,
+		Passphrase: "open sesame",
+	}
+	err := m.Insert(inserted)
+	assert.NilError(t, err)
+	assert.Equal(t, inserted.Protected, true)
+
+	assert.NilError(t, m.Unlock(inserted.ID, "open sesame"))
+
+	for i := 0; i < maxPassphraseFailures; i++ {
+		err = m.Unlock(inserted.ID, "wrong")
+		assert.Equal(t, err, ErrInvalidCredentials)
+	}
+
+	// Even the right passphrase is turned away while the snippet is locked
+	err = m.Unlock(inserted.ID, "open sesame")
+	assert.Equal(t, err, ErrTooManyAttempts)
+
+	// and protected snippets aren't searchable
+	page, err := m.Search("hunter2", 0, "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(page.Snippets), 0)
+}
+
+func TestPassphraseLockout(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{
+			name:     "First lockout",
+			failures: maxPassphraseFailures,
+			want:     time.Minute,
+		},
+		{
+			name:     "Doubles",
+			failures: maxPassphraseFailures + 2,
+			want:     4 * time.Minute,
+		},
+		{
+			name:     "Capped",
+			failures: maxPassphraseFailures + 50,
+			want:     time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, passphraseLockout(tt.failures), tt.want)
+		})
+	}
+}
+
+func TestSnippetModelExpiry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	m := SnippetModel{DB: db}
+
+	now := time.Now().UTC()
+
+	snippets := map[string]*Snippet{
+		"never":   {},
+		"expired": {Expires: now.Add(-time.Minute)},
+		"soon":    {Expires: now.Add(10 * time.Minute)},
+	}
+	for title, s := range snippets {
+		s.UserID = 1
+		s.Title = title
+		s.Content = "An old silent pond..."
+		s.Language = "text"
+		s.Visibility = VisibilityPublic
+		assert.NilError(t, m.Insert(s))
+	}
+
+	s, err := m.Get(snippets["never"].ID)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Expires.IsZero(), true)
+
+	_, err = m.Get(snippets["expired"].ID)
+	assert.Equal(t, err, ErrNoRecord)
+
+	page, err := m.List(ListOptions{Sort: SortNewest})
+	assert.NilError(t, err)
+	assert.Equal(t, len(page.Snippets), 2)
+
+	// Listing by expiry leaves out the snippet that never expires
+	page, err = m.List(ListOptions{Sort: SortExpiring})
+	assert.NilError(t, err)
+	assert.Equal(t, len(page.Snippets), 1)
+	assert.Equal(t, page.Snippets[0].Title, "soon")
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	m := SnippetModel{DB: db}
+
+	now := time.Now().UTC()
+
+	for _, expires := range []time.Time{{}, now.Add(-48 * time.Hour), now.Add(-47 * time.Hour), now.Add(-time.Hour)} {
+		err := m.Insert(&Snippet{
+			UserID:     1,
+			Title:      "An old silent pond",
+			Content:    "An old silent pond...",
+			Language:   "text",
+			Visibility: VisibilityPublic,
+			Expires:    expires,
+		})
+		assert.NilError(t, err)
+	}
+
+	// Only the two that expired more than a day ago are due, one batch at a time
+	n, err := m.DeleteExpired(now.Add(-24*time.Hour), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = m.DeleteExpired(now.Add(-24*time.Hour), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = m.DeleteExpired(now.Add(-24*time.Hour), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+}
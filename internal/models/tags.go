@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+type TagModelInterface interface {
+	Set(snippetID int, tags []string) error
+	ForSnippet(snippetID int) ([]string, error)
+	Snippets(tag string, limit int) ([]*Snippet, error)
+	Cloud(limit int) ([]*TagCount, error)
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// Set replaces a snippet's tags, creating any tags that don't exist yet
+func (m *TagModel) Set(snippetID int, tags []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setTags(tx, snippetID, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Does the work of Set, which takes more than one statement so should be done in a transaction
+func setTags(db execer, snippetID int, tags []string) error {
+	_, err := db.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		// Build one multi-row statement for each insert, e.g. VALUES (?), (?), (?)
+		placeholders := strings.TrimSuffix(strings.Repeat("(?), ", len(tags)), ", ")
+		args := make([]any, len(tags))
+		for i, tag := range tags {
+			args[i] = tag
+		}
+
+		_, err = db.Exec(`INSERT IGNORE INTO tags (name) VALUES `+placeholders, args...)
+		if err != nil {
+			return err
+		}
+
+		stmt := `INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT ?, id FROM tags WHERE name IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(tags)), ", ") + `)`
+
+		_, err = db.Exec(stmt, append([]any{snippetID}, args...)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForSnippet returns a snippet's tag names in alphabetical order
+func (m *TagModel) ForSnippet(snippetID int) ([]string, error) {
+	stmt := `SELECT t.name FROM tags t
+	INNER JOIN snippet_tags st ON st.tag_id = t.id
+	WHERE st.snippet_id = ? ORDER BY t.name`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Snippets returns the latest unexpired public snippets with a tag, newest first
+func (m *TagModel) Snippets(tag string, limit int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets s
+	INNER JOIN users u ON u.id = s.user_id
+	INNER JOIN snippet_tags st ON st.snippet_id = s.id
+	INNER JOIN tags t ON t.id = st.tag_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.visibility = 'public' AND t.name = ?
+	ORDER BY s.created DESC, s.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, tag, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Cloud returns the most used tags with how many unexpired public snippets carry each, in alphabetical
+// order
+func (m *TagModel) Cloud(limit int) ([]*TagCount, error) {
+	stmt := `SELECT name, count FROM (
+		SELECT t.name, COUNT(*) AS count FROM tags t
+		INNER JOIN snippet_tags st ON st.tag_id = t.id
+		INNER JOIN snippets s ON s.id = st.snippet_id
+		WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.visibility = 'public'
+		GROUP BY t.id, t.name
+		ORDER BY count DESC, t.name LIMIT ?
+	) AS top ORDER BY name`
+
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cloud := []*TagCount{}
+
+	for rows.Next() {
+		tc := &TagCount{}
+		if err := rows.Scan(&tc.Name, &tc.Count); err != nil {
+			return nil, err
+		}
+		cloud = append(cloud, tc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cloud, nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestTagModelSet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	snippets := SnippetModel{DB: db}
+	m := TagModel{DB: db}
+
+	s := &Snippet{
+		UserID:     1,
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Language:   "text",
+		Visibility: VisibilityPublic,
+	}
+	err := snippets.Insert(s)
+	assert.NilError(t, err)
+	id := s.ID
+
+	err = m.Set(id, []string{"poetry", "haiku"})
+	assert.NilError(t, err)
+
+	// Setting again replaces the tags rather than adding to them
+	err = m.Set(id, []string{"haiku", "japanese"})
+	assert.NilError(t, err)
+
+	tags, err := m.ForSnippet(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tags), 2)
+	assert.Equal(t, tags[0], "haiku")
+	assert.Equal(t, tags[1], "japanese")
+
+	tagged, err := m.Snippets("haiku", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tagged), 1)
+	assert.Equal(t, tagged[0].ID, id)
+
+	cloud, err := m.Cloud(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(cloud), 2)
+	assert.Equal(t, cloud[0].Name, "haiku")
+	assert.Equal(t, cloud[0].Count, 1)
+}
@@ -1,26 +1,113 @@
+CREATE TABLE users ( 
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
+  name VARCHAR(255) NOT NULL, 
+  email VARCHAR(255) NOT NULL, 
+  hashed_password CHAR(60) NOT NULL, 
+  session_version INTEGER NOT NULL DEFAULT 0, 
+  created DATETIME NOT NULL 
+);
+
+ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+
 CREATE TABLE snippets ( 
   id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
+  slug CHAR(10) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, 
+  user_id INTEGER NOT NULL, 
   title VARCHAR(100) NOT NULL, 
   content TEXT NOT NULL, 
+  language VARCHAR(20) NOT NULL DEFAULT 'text', 
+  visibility VARCHAR(10) NOT NULL DEFAULT 'public', 
+  burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE, 
+  burned DATETIME NULL, 
+  passphrase_hash CHAR(60) NULL, 
+  passphrase_failures INTEGER NOT NULL DEFAULT 0, 
+  passphrase_retry DATETIME NULL, 
   created DATETIME NOT NULL, 
-  expires DATETIME NOT NULL 
+  updated DATETIME NOT NULL, 
+  expires DATETIME NULL, 
+  CONSTRAINT snippets_uc_slug UNIQUE (slug), 
+  CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users(id) 
 );
 
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_expires ON snippets(expires);
+CREATE INDEX idx_snippets_burned ON snippets(burned);
+CREATE FULLTEXT INDEX idx_snippets_fulltext ON snippets(title, content);
 
-CREATE TABLE users ( 
+CREATE TABLE snippet_revisions ( 
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
+  snippet_id INTEGER NOT NULL, 
+  user_id INTEGER NOT NULL, 
+  title VARCHAR(100) NOT NULL, 
+  content TEXT NOT NULL, 
+  created DATETIME NOT NULL, 
+  CONSTRAINT fk_snippet_revisions_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE, 
+  CONSTRAINT fk_snippet_revisions_user FOREIGN KEY (user_id) REFERENCES users(id) 
+);
+
+CREATE TABLE tags ( 
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
+  name VARCHAR(30) NOT NULL, 
+  CONSTRAINT tags_uc_name UNIQUE (name) 
+);
+
+CREATE TABLE snippet_tags ( 
+  snippet_id INTEGER NOT NULL, 
+  tag_id INTEGER NOT NULL, 
+  PRIMARY KEY (snippet_id, tag_id), 
+  CONSTRAINT fk_snippet_tags_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE, 
+  CONSTRAINT fk_snippet_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE 
+);
+
+CREATE TABLE tokens ( 
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
+  user_id INTEGER NOT NULL, 
+  name VARCHAR(100) NOT NULL, 
+  hash BINARY(32) NOT NULL, 
+  scopes VARCHAR(50) NOT NULL, 
+  created DATETIME NOT NULL, 
+  last_used DATETIME NULL, 
+  CONSTRAINT tokens_uc_hash UNIQUE (hash), 
+  CONSTRAINT fk_tokens_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE 
+);
+
+CREATE TABLE password_resets ( 
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
+  user_id INTEGER NOT NULL, 
+  hash BINARY(32) NOT NULL, 
+  created DATETIME NOT NULL, 
+  expires DATETIME NOT NULL, 
+  CONSTRAINT password_resets_uc_hash UNIQUE (hash), 
+  CONSTRAINT fk_password_resets_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE 
+);
+
+CREATE INDEX idx_password_resets_expires ON password_resets(expires);
+
+CREATE TABLE sessions ( 
+  token CHAR(43) PRIMARY KEY, 
+  data BLOB NOT NULL, 
+  expiry TIMESTAMP(6) NOT NULL 
+);
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+
+CREATE TABLE login_attempts ( 
   id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
-  name VARCHAR(255) NOT NULL, 
   email VARCHAR(255) NOT NULL, 
-  hashed_password CHAR(60) NOT NULL, 
-  created DATETIME NOT NULL 
+  user_id INTEGER NULL, 
+  ip VARCHAR(45) NOT NULL, 
+  result VARCHAR(10) NOT NULL, 
+  created DATETIME NOT NULL, 
+  CONSTRAINT fk_login_attempts_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL 
 );
 
-ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+CREATE INDEX idx_login_attempts_email ON login_attempts(email, created);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip, created);
+CREATE INDEX idx_login_attempts_created ON login_attempts(created);
 
 INSERT INTO users (name, email, hashed_password, created) VALUES ( 
   'Astarion Ancunin', 
   'lilstar@bg3.com', 
   '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG', 
   '2024-06-07 10:00:00' 
-);
\ No newline at end of file
+);
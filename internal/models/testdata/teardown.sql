@@ -1,3 +1,17 @@
-DROP TABLE users;
+DROP TABLE login_attempts;
 
-DROP TABLE snippets;
\ No newline at end of file
+DROP TABLE sessions;
+
+DROP TABLE password_resets;
+
+DROP TABLE tokens;
+
+DROP TABLE snippet_tags;
+
+DROP TABLE tags;
+
+DROP TABLE snippet_revisions;
+
+DROP TABLE snippets;
+
+DROP TABLE users;
\ No newline at end of file
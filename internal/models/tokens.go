@@ -0,0 +1,195 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Scopes a personal access token can be granted
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Prefixed to every token so they're easy to recognise, e.g. by secret scanners
+const tokenPrefix = "sbx_"
+
+// Token is a personal access token for API clients. Only a SHA-256 hash of the token is stored,
+// so Plaintext is only ever set on the Token returned by Insert.
+type Token struct {
+	ID        int
+	UserID    int
+	Name      string
+	Scopes    []string
+	Created   time.Time
+	LastUsed  time.Time // zero if the token has never been used
+	Plaintext string
+}
+
+// HasScope reports whether the token was granted scope
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type TokenModelInterface interface {
+	Insert(userID int, name string, scopes []string) (*Token, error)
+	List(userID int) ([]*Token, error)
+	Revoke(userID, id int) error
+	Authenticate(plaintext string) (*Token, error)
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// Insert generates a new random token for the user and stores its hash
+func (m *TokenModel) Insert(userID int, name string, scopes []string) (*Token, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Token{
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		Plaintext: tokenPrefix + plaintext,
+	}
+	hash := sha256.Sum256([]byte(t.Plaintext))
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, scopes, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, userID, name, hash[:], strings.Join(scopes, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	t.ID = int(id)
+	t.Created = time.Now().UTC()
+
+	return t, nil
+}
+
+// List returns the user's tokens, newest first
+func (m *TokenModel) List(userID int) ([]*Token, error) {
+	stmt := `SELECT id, user_id, name, scopes, created, last_used FROM tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes one of the user's tokens. Returns ErrNoRecord if the token doesn't exist or
+// belongs to someone else.
+func (m *TokenModel) Revoke(userID, id int) error {
+	stmt := `DELETE FROM tokens WHERE user_id = ? AND id = ?`
+
+	result, err := m.DB.Exec(stmt, userID, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Authenticate looks up a token by the hash of its plaintext and records that it was used.
+// Returns ErrInvalidCredentials if no such token exists.
+func (m *TokenModel) Authenticate(plaintext string) (*Token, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	stmt := `SELECT id, user_id, name, scopes, created, last_used FROM tokens WHERE hash = ?`
+
+	t, err := scanToken(m.DB.QueryRow(stmt, hash[:]))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	stmt = `UPDATE tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?`
+
+	_, err = m.DB.Exec(stmt, t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Returns 160 random bits, base32 encoded in lower case so they're safe in URLs
+func randomToken() (string, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)), nil
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row scanner) (*Token, error) {
+	t := &Token{}
+	var scopes string
+	var lastUsed sql.NullTime
+
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.Created, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	t.LastUsed = lastUsed.Time
+
+	return t, nil
+}
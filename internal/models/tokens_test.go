@@ -0,0 +1,110 @@
+package models
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/mhrdini/snippetbox/internal/assert"
+)
+
+func TestTokenModelInsert(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := TokenModel{DB: db}
+
+	token, err := m.Insert(1, "CI", []string{ScopeRead, ScopeWrite})
+	assert.NilError(t, err)
+	assert.Equal(t, strings.HasPrefix(token.Plaintext, tokenPrefix), true)
+
+	// Only the hash is stored
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM tokens WHERE hash = ?`, token.Plaintext).Scan(&n)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	err = db.QueryRow(`SELECT COUNT(*) FROM tokens WHERE hash = ?`, hash[:]).Scan(&n)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	// Every token is different
+	other, err := m.Insert(1, "CI", []string{ScopeRead})
+	assert.NilError(t, err)
+	assert.Equal(t, other.Plaintext == token.Plaintext, false)
+
+	tokens, err := m.List(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 2)
+	assert.Equal(t, tokens[0].ID, other.ID)
+	assert.Equal(t, tokens[1].Plaintext, "")
+}
+
+func TestTokenModelAuthenticate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := TokenModel{DB: db}
+
+	token, err := m.Insert(1, "CI", []string{ScopeRead})
+	assert.NilError(t, err)
+
+	tokens, err := m.List(1)
+	assert.NilError(t, err)
+	assert.Equal(t, tokens[0].LastUsed.IsZero(), true)
+
+	got, err := m.Authenticate(token.Plaintext)
+	assert.NilError(t, err)
+	assert.Equal(t, got.ID, token.ID)
+	assert.Equal(t, got.UserID, 1)
+	assert.Equal(t, got.HasScope(ScopeRead), true)
+	assert.Equal(t, got.HasScope(ScopeWrite), false)
+
+	// Using a token records when it was last used
+	tokens, err = m.List(1)
+	assert.NilError(t, err)
+	assert.Equal(t, tokens[0].LastUsed.IsZero(), false)
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{name: "Unknown token", plaintext: tokenPrefix + "abcdefghijklmnopqrstuvwxyz234567"},
+		{name: "Empty", plaintext: ""},
+		{name: "Without prefix", plaintext: strings.TrimPrefix(token.Plaintext, tokenPrefix)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Authenticate(tt.plaintext)
+			assert.Equal(t, err, ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestTokenModelRevoke(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := TokenModel{DB: db}
+
+	token, err := m.Insert(1, "CI", []string{ScopeRead})
+	assert.NilError(t, err)
+
+	// Only the token's owner can revoke it
+	assert.Equal(t, m.Revoke(2, token.ID), ErrNoRecord)
+
+	assert.NilError(t, m.Revoke(1, token.ID))
+
+	_, err = m.Authenticate(token.Plaintext)
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	assert.Equal(t, m.Revoke(1, token.ID), ErrNoRecord)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"strings"
@@ -19,13 +20,18 @@ type User struct {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB         *sql.DB
+	BcryptCost int // cost of hashing passwords, bcrypt.DefaultCost if below bcrypt.MinCost
 }
 
 type UserModelInterface interface {
 	Exists(id int) (bool, error)
 	Insert(name, email, password string) error
-	Authenticate(email, password string) (int, error)
+	Authenticate(email, password, ip string) (int, error)
+	GetByEmail(email string) (*User, error)
+	SessionVersion(id int) (int, error)
+	UpdatePassword(id int, password, ip string) error
+	ResetPassword(token, password, ip string) (int, error)
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
@@ -38,7 +44,7 @@ func (m *UserModel) Exists(id int) (bool, error) {
 }
 
 func (m *UserModel) Insert(name, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.BcryptCost)
 	if err != nil {
 		return err
 	}
@@ -61,19 +67,42 @@ func (m *UserModel) Insert(name, email, password string) error {
 	return nil
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+// Authenticate returns the ID of the user with the given email and password, recording the attempt
+// in login_attempts. While too many attempts for the email or from ip have failed it returns a
+// *LockoutError, without checking the password.
+func (m *UserModel) Authenticate(email, password, ip string) (int, error) {
 	var id int
 	var hashedPassword []byte
 
 	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
 
 	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	// The attempt is recorded as a failure before anything is checked, and the lockout only counts
+	// attempts recorded before it. Concurrent guesses each see the ones that came first, so they
+	// can't all get in under the limit.
+	attempt, err := recordLogin(m.DB, email, id, ip, LoginFailed)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, ErrInvalidCredentials
-		} else {
+		return 0, err
+	}
+
+	until, err := loginLockedUntil(m.DB, email, ip, attempt)
+	if err != nil {
+		return 0, err
+	}
+	if time.Now().Before(until) {
+		err = setLoginResult(m.DB, attempt, LoginLocked)
+		if err != nil {
 			return 0, err
 		}
+		return 0, &LockoutError{Until: until}
+	}
+
+	if id == 0 {
+		return 0, ErrInvalidCredentials
 	}
 
 	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
@@ -85,5 +114,147 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
+	// Recording the success is what resets the account's failures
+	err = setLoginResult(m.DB, attempt, LoginSucceeded)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetByEmail returns the user with the given email, or ErrNoRecord if there isn't one
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	stmt := `SELECT id, name, email, hashed_password, created FROM users WHERE email = ?`
+
+	u := &User{}
+	err := m.DB.QueryRow(stmt, email).Scan(&u.ID, &u.Name, &u.Email, &u.HashedPassword, &u.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// SessionVersion returns the user's session version, which changes whenever their password does.
+// Sessions logged in with an older version are no longer valid. Returns ErrNoRecord if there's no
+// such user.
+func (m *UserModel) SessionVersion(id int) (int, error) {
+	stmt := `SELECT session_version FROM users WHERE id = ?`
+
+	var version int
+	err := m.DB.QueryRow(stmt, id).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// UpdatePassword replaces the user's password, changed from ip, returning ErrNoRecord if there's
+// no such user. See changePassword for what else changes with it.
+func (m *UserModel) UpdatePassword(id int, password, ip string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = changePassword(tx, id, hashedPassword, ip)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword uses up a password reset token to replace the password of the user it was issued
+// to, returning their ID. Nothing changes unless it all does, so a failure leaves the token
+// usable. Returns ErrInvalidCredentials if the token doesn't exist or has expired.
+func (m *UserModel) ResetPassword(token, password, ip string) (int, error) {
+	// Hashed before the transaction, so the token's row isn't locked while bcrypt runs
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.BcryptCost)
+	if err != nil {
+		return 0, err
+	}
+	hash := sha256.Sum256([]byte(token))
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locked so that, of two requests using the same token at once, only one gets its user
+	stmt := `SELECT user_id FROM password_resets WHERE hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+
+	var id int
+	err = tx.QueryRow(stmt, hash[:]).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	err = changePassword(tx, id, hashedPassword, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
 	return id, nil
 }
+
+// Replaces a user's password within tx, and cuts off anyone who got in with the old one: their
+// sessions are invalidated by bumping the session version, and their personal access tokens and
+// password reset tokens are deleted. A reset login attempt is recorded, which ends any lockout of
+// the account, since whoever changed the password has proven they own it.
+func changePassword(tx *sql.Tx, id int, hashedPassword []byte, ip string) error {
+	stmt := `UPDATE users SET hashed_password = ?, session_version = session_version + 1 WHERE id = ?`
+
+	result, err := tx.Exec(stmt, string(hashedPassword), id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	for _, stmt := range []string{
+		`DELETE FROM tokens WHERE user_id = ?`,
+		`DELETE FROM password_resets WHERE user_id = ?`,
+	} {
+		_, err = tx.Exec(stmt, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt = `INSERT INTO login_attempts (email, user_id, ip, result, created)
+	SELECT email, id, ?, ?, UTC_TIMESTAMP() FROM users WHERE id = ?`
+
+	_, err = tx.Exec(stmt, ip, LoginReset, id)
+	return err
+}
@@ -1,9 +1,14 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mhrdini/snippetbox/internal/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserModelExists(t *testing.T) {
@@ -25,7 +30,7 @@ func TestUserModelExists(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			db := newTestDB(t)
 
-			m := UserModel{db}
+			m := UserModel{DB: db}
 
 			got, err := m.Exists(tt.userID)
 
@@ -34,3 +39,210 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelAuthenticateLockout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	for i := 0; i < maxAccountFailures; i++ {
+		_, err := m.Authenticate("lilstar@bg3.com", "wrong password", "192.0.2.1")
+		assert.Equal(t, err, ErrInvalidCredentials)
+	}
+
+	// The account is locked, from any address, without the password being checked
+	_, err := m.Authenticate("lilstar@bg3.com", "wrong password", "192.0.2.2")
+	var lockout *LockoutError
+	assert.Equal(t, errors.As(err, &lockout), true)
+	assert.Equal(t, errors.Is(err, ErrTooManyAttempts), true)
+	assert.Equal(t, lockout.Until.After(time.Now()), true)
+
+	// Refused attempts are still recorded against the account
+	var userID int
+	err = db.QueryRow(`SELECT user_id FROM login_attempts WHERE result = ?`, LoginLocked).Scan(&userID)
+	assert.NilError(t, err)
+	assert.Equal(t, userID, 1)
+
+	// but other accounts aren't
+	_, err = m.Authenticate("nobody@example.com", "wrong password", "192.0.2.2")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	// A successful login resets the account's failures
+	_, err = db.Exec(`INSERT INTO login_attempts (email, user_id, ip, result, created)
+	VALUES ('lilstar@bg3.com', 1, '192.0.2.1', ?, UTC_TIMESTAMP())`, LoginSucceeded)
+	assert.NilError(t, err)
+	_, err = m.Authenticate("lilstar@bg3.com", "wrong password", "192.0.2.1")
+	assert.Equal(t, err, ErrInvalidCredentials)
+}
+
+func TestUserModelAuthenticateConcurrent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	// Guesses made all at once get no more past the lockout than guesses made one at a time
+	errs := make(chan error, 2*maxAccountFailures)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Authenticate("lilstar@bg3.com", "wrong password", "192.0.2.1")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	checked := 0
+	for err := range errs {
+		if err == ErrInvalidCredentials {
+			checked++
+		} else if !errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, checked, maxAccountFailures)
+}
+
+func TestUserModelAuthenticateIPLockout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	// Spread over enough accounts that none of them is locked
+	for i := 0; i < maxIPFailures; i++ {
+		email := fmt.Sprintf("guess%d@example.com", i%(maxAccountFailures-1))
+		_, err := m.Authenticate(email, "wrong password", "192.0.2.1")
+		assert.Equal(t, err, ErrInvalidCredentials)
+	}
+
+	_, err := m.Authenticate("lilstar@bg3.com", "wrong password", "192.0.2.1")
+	assert.Equal(t, errors.Is(err, ErrTooManyAttempts), true)
+
+	_, err = m.Authenticate("lilstar@bg3.com", "wrong password", "192.0.2.2")
+	assert.Equal(t, err, ErrInvalidCredentials)
+}
+
+func TestLockedUntil(t *testing.T) {
+	last := time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Time
+	}{
+		{
+			name:     "Under the threshold",
+			failures: maxAccountFailures - 1,
+			want:     time.Time{},
+		},
+		{
+			name:     "First lockout",
+			failures: maxAccountFailures,
+			want:     last.Add(minLoginLockout),
+		},
+		{
+			name:     "Doubles",
+			failures: maxAccountFailures + 3,
+			want:     last.Add(8 * minLoginLockout),
+		},
+		{
+			name:     "Capped",
+			failures: maxAccountFailures + 50,
+			want:     last.Add(maxLoginLockout),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, lockedUntil(tt.failures, last, maxAccountFailures), tt.want)
+		})
+	}
+}
+
+func TestUserModelUpdatePassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db, BcryptCost: bcrypt.MinCost}
+
+	u, err := m.GetByEmail("lilstar@bg3.com")
+	assert.NilError(t, err)
+	assert.Equal(t, u.ID, 1)
+
+	_, err = m.GetByEmail("nobody@example.com")
+	assert.Equal(t, err, ErrNoRecord)
+
+	err = m.UpdatePassword(1, "new password", "192.0.2.1")
+	assert.NilError(t, err)
+	err = m.UpdatePassword(2, "new password", "192.0.2.1")
+	assert.Equal(t, err, ErrNoRecord)
+
+	version, err := m.SessionVersion(1)
+	assert.NilError(t, err)
+	assert.Equal(t, version, 1)
+
+	id, err := m.Authenticate("lilstar@bg3.com", "new password", "192.0.2.1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+}
+
+func TestUserModelResetPassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db, BcryptCost: bcrypt.MinCost}
+	resets := PasswordResetModel{db}
+	tokens := TokenModel{db}
+
+	first, err := resets.Insert(1)
+	assert.NilError(t, err)
+	second, err := resets.Insert(1)
+	assert.NilError(t, err)
+	token, err := tokens.Insert(1, "Deploy script", []string{ScopeRead})
+	assert.NilError(t, err)
+
+	// Locked out, as someone who's forgotten their password may well be
+	for i := 0; i < maxAccountFailures; i++ {
+		_, err = m.Authenticate("lilstar@bg3.com", "wrong password", "192.0.2.1")
+		assert.Equal(t, err, ErrInvalidCredentials)
+	}
+
+	_, err = m.ResetPassword("not a token", "new password", "192.0.2.1")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	id, err := m.ResetPassword(first, "new password", "192.0.2.1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	// The token is used up, and the user's other reset and access tokens have gone with it
+	_, err = m.ResetPassword(first, "another password", "192.0.2.1")
+	assert.Equal(t, err, ErrInvalidCredentials)
+	assert.Equal(t, resets.Check(second), ErrInvalidCredentials)
+	_, err = tokens.Authenticate(token.Plaintext)
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	// Sessions logged in before the reset are invalid
+	version, err := m.SessionVersion(1)
+	assert.NilError(t, err)
+	assert.Equal(t, version, 1)
+
+	// and the lockout is over
+	id, err = m.Authenticate("lilstar@bg3.com", "new password", "192.0.2.1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+}
@@ -6,6 +6,9 @@ import (
 	"unicode/utf8"
 )
 
+// Tags are lowercase words which may contain digits and inner hyphens, e.g. "go" or "k8s-yaml"
+var TagRX = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
 type Validator struct {
@@ -62,3 +65,27 @@ func ValidValue[T comparable](value T, permittedValues ...T) bool {
 
 	return false
 }
+
+func MaxCount[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
+func AllMatch(values []string, rx *regexp.Regexp) bool {
+	for _, value := range values {
+		if !rx.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func AllMaxChars(values []string, n int) bool {
+	for _, value := range values {
+		if !MaxChars(value, n) {
+			return false
+		}
+	}
+
+	return true
+}